@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -9,22 +10,30 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"text/tabwriter"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	extflag "github.com/efficientgo/tools/extkingpin"
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/oklog/run"
+	"github.com/oklog/ulid"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	promModel "github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/thanos-io/objstore"
 	"github.com/thanos-io/objstore/client"
+	"github.com/thanos-io/objstore/providers/filesystem"
 	"github.com/thanos-io/thanos/pkg/block"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
 	"github.com/thanos-io/thanos/pkg/extkingpin"
 	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanosbench/pkg/blockgen"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"gopkg.in/yaml.v2"
 )
@@ -45,16 +54,36 @@ func registerBlock(m map[string]setupFunc, app *kingpin.Application) {
 	cmd := app.Command("block", "Tools for generating TSDB/Prometheus blocks")
 	registerBlockGen(m, cmd)
 	registerBlockPlan(m, cmd)
+	registerBlockVerify(m, cmd)
+	registerBlockStats(m, cmd)
 }
 func registerBlockGen(m map[string]setupFunc, root *kingpin.CmdClause) {
-	cmd := root.Command("gen", "Generates Prometheus/Thanos TSDB blocks from input. Expects []blockgen.BlockSpec in YAML format as input.")
+	cmd := root.Command("gen", "Generates Prometheus/Thanos TSDB blocks from input. Expects []blockgen.BlockSpec in YAML format as input. Each spec has a stable block ID derived from its content hash, so blocks already in output directory or bucket are skipped and interrupted generation can be resumed by running it again.")
 	config := extflag.RegisterPathOrContent(cmd, "config", "YAML for  []blockgen.BlockSpec. Leave this empty in order to be able to pass this through STDIN", extflag.WithEnvSubstitution())
 	objStore := *extkingpin.RegisterCommonObjStoreFlags(cmd, "", false)
 	outputDir := cmd.Flag("output.dir", "Output directory for generated data.").Required().String()
 	workers := cmd.Flag("workers", "Number of go routines for block generation. If 0, 2*runtime.GOMAXPROCS(0) is used.").Int()
-	m["block gen"] = func(g *run.Group, logger log.Logger) error {
+	commitSamples := cmd.Flag("commit.samples", "Number of samples after which each worker commits appended samples into the head. Lower values bound memory of uncommitted samples. If 0, each worker commits once per block.").Int()
+	commitSeries := cmd.Flag("commit.series", "Number of series after which each worker commits appended samples into the head. If 0, each worker commits once per block.").Int()
+	maxPendingSamples := cmd.Flag("commit.max-pending-samples", "Maximum number of uncommitted samples of all workers together. Workers wait for others to commit above this limit. If 0, there is no limit.").Int64()
+	writer := cmd.Flag("writer", "Block writer to use. 'head' appends series into TSDB head and compacts it into a block, 'streaming' writes chunks directly to disk, so memory does not grow with block time range, but out-of-order samples are not supported.").Default("head").Enum("head", "streaming")
+	concurrency := cmd.Flag("concurrency", "Number of blocks generated at the same time. Each block uses its own --workers go routines. Generated blocks are uploaded while the next ones are generated.").Default("1").Int()
+	memoryBudget := cmd.Flag("memory-budget", "Maximum estimated memory of blocks generated at the same time, e.g. 8GiB. Blocks wait for memory of others to be released. A block estimated above the budget is generated alone. If 0, only --concurrency limits generation.").Default("0").Bytes()
+	progressInterval := registerProgressFlag(cmd)
+	seed := registerSeedFlag(cmd, "If not 0, it overrides seed of all block specs.")
+	m["block gen"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry) error {
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
+			progress := seriesgen.NewProgress(reg)
+			if *progressInterval > 0 {
+				go progress.Log(ctx, logger, *progressInterval)
+			}
+			appendOpts := []seriesgen.AppendOption{
+				seriesgen.WithProgressHook(progress),
+				seriesgen.WithCommitBatch(*commitSamples, *commitSeries),
+				seriesgen.WithMaxPendingSamples(*maxPendingSamples),
+			}
+
 			goroutines := *workers
 			if goroutines == 0 {
 				goroutines = 2 * runtime.GOMAXPROCS(0)
@@ -84,69 +113,137 @@ func registerBlockGen(m map[string]setupFunc, root *kingpin.CmdClause) {
 				}
 			}
 
-			n := 0
-			if len(cfg) > 0 {
-				bs := []blockgen.BlockSpec{}
-				if err := yaml.UnmarshalStrict(cfg, &bs); err != nil {
-					return err
-				}
-				for _, b := range bs {
-					level.Info(logger).Log("msg", "generating block", "spec", printBlocks(b))
-					id, err := blockgen.Generate(ctx, logger, goroutines, *outputDir, b)
-					if err != nil {
-						return errors.Wrap(err, "generate")
-					}
-					n++
-					blockDir := path.Join(*outputDir, id.String())
-					level.Info(logger).Log("msg", "generated block", "path", blockDir, "count", n)
-					runtime.GC()
-
-					if upload {
-						if err := block.Upload(ctx, logger, bkt, blockDir, metadata.NoneFunc); err != nil {
-							return errors.Wrapf(err, "upload block %s", id)
-						}
-						level.Info(logger).Log("msg", "uploaded block to object storage", "path", blockDir)
-					}
+			generateFn := blockgen.Generate
+			if *writer == "streaming" {
+				generateFn = blockgen.GenerateStreaming
+			}
+			estimate := blockgen.HeadMemoryEstimate
+			if *writer == "streaming" {
+				estimate = blockgen.StreamingMemoryEstimate
+			}
+			progress.Reset(0)
+
+			// Blocks of interrupted runs are generated again, already finished ones are skipped.
+			if err := blockgen.RemovePartial(logger, *outputDir); err != nil {
+				return err
+			}
+			uploaded := func(ctx context.Context, id ulid.ULID) (bool, error) {
+				if !upload {
+					return false, nil
 				}
-				return ctx.Err()
+				// Meta is uploaded last, so block with meta is complete.
+				ok, err := bkt.Exists(ctx, path.Join(id.String(), metadata.MetaFilename))
+				return ok, errors.Wrapf(err, "check block %s in bucket", id)
 			}
 
-			dec := yaml.NewDecoder(os.Stdin)
-			dec.SetStrict(true)
-			for ctx.Err() == nil {
-				b := blockgen.BlockSpec{}
-				err := dec.Decode(&b)
-				if err == io.EOF {
-					level.Info(logger).Log("msg", "all blocks done", "count", n)
-					return nil
+			n := int64(0)
+			generate := func(ctx context.Context, b blockgen.BlockSpec) (ulid.ULID, error) {
+				if *seed != 0 {
+					b.Seed = *seed
 				}
+				id, err := b.ID()
 				if err != nil {
-					return errors.Wrap(err, "decode")
+					return ulid.ULID{}, errors.Wrap(err, "block ID")
+				}
+				if ok, err := uploaded(ctx, id); err != nil || ok {
+					if ok {
+						level.Info(logger).Log("msg", "block already uploaded, skipping", "id", id, "spec", printBlocks(b))
+					}
+					return id, err
+				}
+				if _, err := os.Stat(path.Join(*outputDir, id.String(), metadata.MetaFilename)); err == nil {
+					level.Info(logger).Log("msg", "block already generated, skipping", "path", path.Join(*outputDir, id.String()), "spec", printBlocks(b))
+					return id, nil
 				}
 
 				level.Info(logger).Log("msg", "generating block", "spec", printBlocks(b))
-				id, err := blockgen.Generate(ctx, logger, goroutines, *outputDir, b)
+				progress.Expect(b.NumSeries())
+				fingerprint := seriesgen.NewFingerprint()
+				id, err = generateFn(ctx, logger, goroutines, *outputDir, b, append(appendOpts, seriesgen.WithFingerprint(fingerprint))...)
 				if err != nil {
-					return errors.Wrap(err, "generate")
+					return ulid.ULID{}, errors.Wrap(err, "generate")
 				}
-				n++
-				blockDir := path.Join(*outputDir, id.String())
-				level.Info(logger).Log("msg", "generated block", "path", blockDir, "count", n)
+				// Fingerprint goes to stdout, so generated data can be compared with other runs.
+				fmt.Fprintln(os.Stdout, id.String(), fingerprint.String())
+				level.Info(logger).Log("msg", "generated block", "path", path.Join(*outputDir, id.String()), "count", atomic.AddInt64(&n, 1))
 				runtime.GC()
+				return id, nil
+			}
 
-				if upload {
+			var uploadFn func(context.Context, ulid.ULID) error
+			if upload {
+				uploadFn = func(ctx context.Context, id ulid.ULID) error {
+					if ok, err := uploaded(ctx, id); err != nil || ok {
+						return err
+					}
+					blockDir := path.Join(*outputDir, id.String())
 					if err := block.Upload(ctx, logger, bkt, blockDir, metadata.NoneFunc); err != nil {
 						return errors.Wrapf(err, "upload block %s", id)
 					}
 					level.Info(logger).Log("msg", "uploaded block to object storage", "path", blockDir)
+					return nil
 				}
 			}
-			return ctx.Err()
+
+			next, err := blockSpecReader(cfg)
+			if err != nil {
+				return err
+			}
+
+			if err := blockgen.GeneratePipeline(ctx, next, generate, uploadFn, blockgen.PipelineOptions{
+				Concurrency:    *concurrency,
+				MemoryBudget:   int64(*memoryBudget),
+				MemoryEstimate: estimate,
+			}); err != nil {
+				return err
+			}
+			level.Info(logger).Log("msg", "all blocks done", "count", atomic.LoadInt64(&n))
+			return nil
 		}, func(error) { cancel() })
 		return nil
 	}
 }
 
+// blockSpecReader returns function reading block specs one by one from given YAML list or, if empty, from
+// YAML documents on stdin. It returns io.EOF after the last spec.
+func blockSpecReader(cfg []byte) (func() (blockgen.BlockSpec, error), error) {
+	if len(cfg) > 0 {
+		bs := []blockgen.BlockSpec{}
+		if err := yaml.UnmarshalStrict(cfg, &bs); err != nil {
+			return nil, err
+		}
+		return func() (blockgen.BlockSpec, error) {
+			if len(bs) == 0 {
+				return blockgen.BlockSpec{}, io.EOF
+			}
+			b := bs[0]
+			bs = bs[1:]
+			return b, nil
+		}, nil
+	}
+
+	dec := yaml.NewDecoder(os.Stdin)
+	dec.SetStrict(true)
+	return func() (blockgen.BlockSpec, error) {
+		b := blockgen.BlockSpec{}
+		if err := dec.Decode(&b); err != nil {
+			if err == io.EOF {
+				return b, err
+			}
+			return b, errors.Wrap(err, "decode")
+		}
+		return b, nil
+	}, nil
+}
+
+func registerProgressFlag(cmd *kingpin.CmdClause) *time.Duration {
+	return cmd.Flag("progress-interval", "Interval of logging generation progress. Disabled if 0.").Default("30s").Duration()
+}
+
+func registerSeedFlag(cmd *kingpin.CmdClause, help string) *int64 {
+	return cmd.Flag("seed", "Seed of generated values. The same seed and input generates the same data, with fingerprint printed to stdout. "+help).Int64()
+}
+
 func parseFlagLabels(s []string) (labels.Labels, error) {
 	var lset labels.Labels
 	for _, l := range s {
@@ -175,18 +272,227 @@ Example plan with generation:
 	profile := cmd.Flag("profile", "Name of the harcoded profile to use").Required().Short('p').Enum(blockgen.Profiles.Keys()...)
 	maxTime := model.TimeOrDuration(cmd.Flag("max-time", "If empty current time - 30m (usual consistency delay) is used.").Default("30m"))
 	extLset := cmd.Flag("labels", "External labels for block stream (repeated).").PlaceHolder("<name>=\"<value>\"").Strings()
-	m["block plan"] = func(g *run.Group, _ log.Logger) error {
+	seed := cmd.Flag("seed", "Seed of generated values, written into all block specs.").Int64()
+	compacted := cmd.Flag("compaction", "Set compaction level, sources and parents of blocks as if Thanos compactor compacted them from 2h blocks.").Bool()
+	overlap := cmd.Flag("overlap", "Type of overlapping 2h blocks to add. 'vertical' overlaps the newest 2h of a block with different sources and needs vertical compaction, 'duplicate' has one of sources of the overlapped block and requires --compaction.").
+		Default(string(blockgen.NoOverlap)).Enum(string(blockgen.NoOverlap), string(blockgen.VerticalOverlap), string(blockgen.DuplicateOverlap))
+	overlapEvery := cmd.Flag("overlap.every", "Add overlapping block after every given number of raw blocks.").Default("1").Int()
+	replicas := cmd.Flag("replicas", "Number of HA replicas of all blocks. Replicas have the same series and values, apart from timestamp offsets, value drift and independent gaps. If 0, blocks are not replicated.").Int()
+	replicaLabel := cmd.Flag("replica.label", "External label with replica index.").Default("replica").String()
+	replicaOffset := cmd.Flag("replica.offset", "Timestamp offset between consecutive replicas.").Default("1s").Duration()
+	replicaDrift := cmd.Flag("replica.drift", "Maximum relative difference of gauge values between replicas.").Default("0.01").Float64()
+	replicaMissedScrapes := cmd.Flag("replica.missed-scrape-probability", "Probability of each scrape being missed by a replica.").Default("0.001").Float64()
+	replicaOutages := cmd.Flag("replica.outage-probability", "Probability of replica going down on each scrape.").Default("0.0001").Float64()
+	replicaOutageDuration := cmd.Flag("replica.outage-duration", "Maximum duration of replica outages.").Default("10m").Duration()
+	m["block plan"] = func(g *run.Group, _ log.Logger, _ *prometheus.Registry) error {
 		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
 			lset, err := parseFlagLabels(*extLset)
 			if err != nil {
 				return err
 			}
+			if blockgen.OverlapType(*overlap) == blockgen.DuplicateOverlap && !*compacted {
+				return errors.New("duplicate overlaps require --compaction")
+			}
 			planFn := blockgen.Profiles[*profile]
+			if *replicas > 0 {
+				planFn = blockgen.Replicated(planFn, blockgen.ReplicaOptions{
+					Replicas: *replicas,
+					Label:    *replicaLabel,
+					Offset:   *replicaOffset,
+					Drift:    *replicaDrift,
+					Gaps: seriesgen.GapCharacteristics{
+						MissedScrapeProbability: *replicaMissedScrapes,
+						OutageProbability:       *replicaOutages,
+						OutageMaxDuration:       *replicaOutageDuration,
+					},
+				})
+			}
+			if *compacted {
+				planFn = blockgen.Compacted(planFn)
+			}
+			planFn = blockgen.Overlapping(planFn, blockgen.OverlapType(*overlap), *overlapEvery)
 
 			enc := yaml.NewEncoder(os.Stdout)
-			return planFn(ctx, *maxTime, lset, func(spec blockgen.BlockSpec) error { return enc.Encode(spec) })
+			return planFn(ctx, *maxTime, lset, func(spec blockgen.BlockSpec) error {
+				spec.Seed = *seed
+				return enc.Encode(spec)
+			})
 		}, func(error) { cancel() })
 		return nil
 	}
 }
+
+func registerBlockVerify(m map[string]setupFunc, root *kingpin.CmdClause) {
+	cmd := root.Command("verify", "Verifies blocks generated by block gen. Checks index health, chunks and meta of each block and compares series, samples and time range with the block spec it was generated from. Expects the same []blockgen.BlockSpec in YAML format as block gen.")
+	config := extflag.RegisterPathOrContent(cmd, "config", "YAML for []blockgen.BlockSpec. Leave this empty in order to be able to pass this through STDIN", extflag.WithEnvSubstitution())
+	dir := cmd.Flag("dir", "Directory with generated blocks.").Required().String()
+	tolerance := cmd.Flag("samples.tolerance", "Maximum relative difference between number of samples in block and in its spec. Specs with gaps are only checked for missing samples.").Default("0.01").Float64()
+	m["block verify"] = func(g *run.Group, logger log.Logger, _ *prometheus.Registry) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			cfg, err := config.Content()
+			if err != nil {
+				return err
+			}
+			next, err := blockSpecReader(cfg)
+			if err != nil {
+				return err
+			}
+			var specs []blockgen.BlockSpec
+			for {
+				b, err := next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				specs = append(specs, b)
+			}
+
+			entries, err := os.ReadDir(*dir)
+			if err != nil {
+				return errors.Wrap(err, "read dir")
+			}
+			var (
+				metas  []*metadata.Meta
+				failed int
+			)
+			for _, e := range entries {
+				if _, err := ulid.Parse(e.Name()); err != nil || !e.IsDir() {
+					continue
+				}
+				meta, err := metadata.ReadFromDir(path.Join(*dir, e.Name()))
+				if err != nil {
+					level.Error(logger).Log("msg", "block verification failed", "block", e.Name(), "err", errors.Wrap(err, "read meta"))
+					failed++
+					continue
+				}
+				metas = append(metas, meta)
+			}
+
+			matched := blockgen.MatchSpecs(metas, specs)
+			specMatched := make([]bool, len(specs))
+			for i, meta := range metas {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				var spec *blockgen.BlockSpec
+				if matched[i] >= 0 {
+					spec = &specs[matched[i]]
+					specMatched[matched[i]] = true
+				} else {
+					level.Warn(logger).Log("msg", "no spec matches block, verifying block alone", "block", meta.ULID)
+				}
+				if err := blockgen.Verify(logger, path.Join(*dir, meta.ULID.String()), spec, *tolerance); err != nil {
+					level.Error(logger).Log("msg", "block verification failed", "block", meta.ULID, "err", err)
+					failed++
+					continue
+				}
+				level.Info(logger).Log("msg", "block verified", "block", meta.ULID)
+			}
+
+			missing := 0
+			for i, ok := range specMatched {
+				if !ok {
+					level.Error(logger).Log("msg", "no block matches spec", "spec", printBlocks(specs[i]), "labels", labels.FromMap(specs[i].Thanos.Labels).String(), "resolution", specs[i].Thanos.Downsample.Resolution)
+					missing++
+				}
+			}
+			if failed > 0 || missing > 0 {
+				return errors.Errorf("%d blocks failed verification, %d specs have no block", failed, missing)
+			}
+			level.Info(logger).Log("msg", "all blocks verified", "count", len(metas))
+			return nil
+		}, func(error) { cancel() })
+		return nil
+	}
+}
+
+func registerBlockStats(m map[string]setupFunc, root *kingpin.CmdClause) {
+	cmd := root.Command("stats", "Summarises blocks and the whole dataset in local directory or object storage: series, samples, chunks, index and chunk sizes, bytes per sample and labels with the highest cardinality.")
+	dir := cmd.Flag("dir", "Local directory with blocks. Mutually exclusive with object store flags.").String()
+	objStore := *extkingpin.RegisterCommonObjStoreFlags(cmd, "", false)
+	output := cmd.Flag("output", "Output format. 'table' is for humans, 'json' for CI.").Default("table").Enum("table", "json")
+	topLabels := cmd.Flag("top-labels", "Number of labels with the highest cardinality to report.").Default("10").Int()
+	m["block stats"] = func(g *run.Group, logger log.Logger, _ *prometheus.Registry) error {
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			objStoreContentYaml, err := objStore.Content()
+			if err != nil {
+				return errors.Wrap(err, "getting object store config")
+			}
+
+			var bkt objstore.Bucket
+			switch {
+			case *dir != "" && len(objStoreContentYaml) > 0:
+				return errors.New("--dir and object store flags are mutually exclusive")
+			case *dir != "":
+				if bkt, err = filesystem.NewBucket(*dir); err != nil {
+					return err
+				}
+			case len(objStoreContentYaml) > 0:
+				if bkt, err = client.NewBucket(logger, objStoreContentYaml, nil, "blockstats"); err != nil {
+					return err
+				}
+			default:
+				return errors.New("one of --dir or object store flags is required")
+			}
+			defer runutil.CloseWithLogOnErr(logger, bkt, "close bucket")
+
+			// Index headers are only needed for label values.
+			tmpDir, err := os.MkdirTemp("", "thanosbench-stats")
+			if err != nil {
+				return err
+			}
+			defer func() { _ = os.RemoveAll(tmpDir) }()
+
+			r, err := blockgen.Report(ctx, logger, bkt, tmpDir, *topLabels)
+			if err != nil {
+				return err
+			}
+			if *output == "json" {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(r)
+			}
+			return printReport(os.Stdout, r)
+		}, func(error) { cancel() })
+		return nil
+	}
+}
+
+func printReport(w io.Writer, r blockgen.DatasetReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ULID\tFROM\tUNTIL\tRANGE\tLABELS\tRES\tLEVEL\tSERIES\tSAMPLES\tCHUNKS\tINDEX\tCHUNK BYTES\tB/SAMPLE\tTOP LABELS")
+	row := func(id string, mint, maxt int64, lset map[string]string, res, lvl string, s blockgen.SizeSummary) {
+		var extLset string
+		if len(lset) > 0 {
+			extLset = labels.FromMap(lset).String()
+		}
+		var top []string
+		for _, l := range s.TopLabels {
+			top = append(top, fmt.Sprintf("%s=%d", l.Name, l.Values))
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%s\t%s\t%.2f\t%s\n",
+			id,
+			time.UnixMilli(mint).UTC().Format(time.RFC3339),
+			time.UnixMilli(maxt).UTC().Format(time.RFC3339),
+			millisToDur(maxt-mint),
+			extLset,
+			res, lvl,
+			s.Series, s.Samples, s.Chunks,
+			humanize.IBytes(uint64(s.IndexBytes)),
+			humanize.IBytes(uint64(s.ChunkBytes)),
+			s.BytesPerSample,
+			strings.Join(top, ","),
+		)
+	}
+	for _, b := range r.Blocks {
+		row(b.ULID.String(), b.MinTime, b.MaxTime, b.Labels, millisToDur(b.Resolution).String(), strconv.Itoa(b.Level), b.SizeSummary)
+	}
+	row(fmt.Sprintf("TOTAL (%d blocks)", len(r.Blocks)), r.MinTime, r.MaxTime, nil, "", "", r.Total)
+	return tw.Flush()
+}
@@ -1,17 +1,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"runtime"
 	"syscall"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/oklog/run"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
 	"go.uber.org/automaxprocs/maxprocs"
 	"gopkg.in/alecthomas/kingpin.v2"
@@ -22,7 +28,7 @@ const (
 	logFormatJson   = "json"
 )
 
-type setupFunc func(*run.Group, log.Logger) error
+type setupFunc func(*run.Group, log.Logger, *prometheus.Registry) error
 
 func main() {
 	if os.Getenv("DEBUG") != "" {
@@ -41,6 +47,7 @@ func main() {
 		Default("info").Enum("error", "warn", "info", "debug")
 	logFormat := app.Flag("log.format", "Log format to use.").
 		Default(logFormatLogfmt).Enum(logFormatLogfmt, logFormatJson)
+	httpAddr := app.Flag("http-address", "Listen host:port for HTTP endpoint exposing Prometheus metrics, e.g. generation progress. Disabled if empty.").String()
 
 	cmds := map[string]setupFunc{}
 	registerWalgen(cmds, app)
@@ -83,7 +90,7 @@ func main() {
 	}
 
 	loggerAdapter := func(template string, args ...interface{}) {
-		level.Debug(logger).Log("msg", fmt.Sprintf(template, args))
+		level.Debug(logger).Log("msg", fmt.Sprintf(template, args...))
 	}
 
 	// Running in container with limits but with empty/wrong value of GOMAXPROCS env var could lead to throttling by cpu
@@ -94,12 +101,32 @@ func main() {
 		fmt.Fprintln(os.Stderr, errors.Wrapf(err, "failed to set GOMAXPROCS: %v", err))
 	}
 
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
 	var g run.Group
-	if err := cmds[cmd](&g, logger); err != nil {
+	if err := cmds[cmd](&g, logger, reg); err != nil {
 		level.Error(logger).Log("err", fmt.Sprintf("%v", errors.Wrapf(err, "%s command failed", cmd)))
 		os.Exit(1)
 	}
 
+	if *httpAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		srv := &http.Server{Addr: *httpAddr, Handler: mux}
+		g.Add(func() error {
+			level.Info(logger).Log("msg", "listening for metrics", "address", *httpAddr)
+			return srv.ListenAndServe()
+		}, func(error) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = srv.Shutdown(ctx)
+		})
+	}
+
 	// Listen for termination signals.
 	{
 		cancel := make(chan struct{})
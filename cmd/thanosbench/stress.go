@@ -12,6 +12,7 @@ import (
 	"github.com/go-kit/log/level"
 	"github.com/oklog/run"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/thanos-io/thanos/pkg/store/storepb"
@@ -35,7 +36,7 @@ func registerStress(m map[string]setupFunc, app *kingpin.Application) {
 
 	// TODO(GiedriusS): send other requests like Info() as well.
 	// TODO(GiedriusS): we could ask for random aggregations.
-	m["stress"] = func(g *run.Group, logger log.Logger) error {
+	m["stress"] = func(g *run.Group, logger log.Logger, _ *prometheus.Registry) error {
 		mainCtx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
 			conn, err := grpc.Dial((*target).String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -1,11 +1,16 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
 
 	extflag "github.com/efficientgo/tools/extkingpin"
 	"github.com/go-kit/log"
 	"github.com/oklog/run"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
 	"github.com/thanos-io/thanosbench/pkg/walgen"
 	"gopkg.in/alecthomas/kingpin.v2"
 	"gopkg.in/yaml.v2"
@@ -16,9 +21,13 @@ func registerWalgen(m map[string]setupFunc, app *kingpin.Application) {
 	config := extflag.RegisterPathOrContent(cmd, "config", "YAML for series config. See walgen.Config for the format.", extflag.WithRequired(), extflag.WithEnvSubstitution())
 
 	outputDir := cmd.Flag("output.dir", "Output directory for generated TSDB data.").Required().String()
+	progressInterval := registerProgressFlag(cmd)
+	seed := registerSeedFlag(cmd, "If not 0, it overrides seed from config.")
+	maxTime := model.TimeOrDuration(cmd.Flag("max-time", "Timestamp of the newest samples, overrides maxTime from config. If both are empty, current time is used."))
 
 	// TODO(bwplotka): Consider mode in which it generates the data only if empty work dir.
-	m["walgen"] = func(g *run.Group, logger log.Logger) error {
+	m["walgen"] = func(g *run.Group, logger log.Logger, reg *prometheus.Registry) error {
+		ctx, cancel := context.WithCancel(context.Background())
 		g.Add(func() error {
 			configContent, err := config.Content()
 			if err != nil {
@@ -31,8 +40,27 @@ func registerWalgen(m map[string]setupFunc, app *kingpin.Application) {
 			if err := yaml.Unmarshal(configContent, &config); err != nil {
 				return err
 			}
-			return walgen.GenerateTSDBWAL(logger, *outputDir, config)
-		}, func(error) {})
+
+			progress := seriesgen.NewProgress(reg)
+			progress.Reset(config.NumSeries())
+			if *progressInterval > 0 {
+				go progress.Log(ctx, logger, *progressInterval)
+			}
+			if *seed != 0 {
+				config.Seed = *seed
+			}
+			if t := maxTime.PrometheusTimestamp(); t != 0 {
+				config.MaxTime = t
+			}
+
+			fingerprint := seriesgen.NewFingerprint()
+			if err := walgen.GenerateTSDBWAL(logger, *outputDir, config, seriesgen.WithProgressHook(progress), seriesgen.WithFingerprint(fingerprint)); err != nil {
+				return err
+			}
+			// Fingerprint goes to stdout, so generated data can be compared with other runs.
+			fmt.Fprintln(os.Stdout, fingerprint.String())
+			return nil
+		}, func(error) { cancel() })
 		return nil
 	}
 }
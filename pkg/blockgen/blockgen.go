@@ -5,16 +5,19 @@ import (
 	"fmt"
 	"math/rand"
 	"path"
+	"reflect"
+	"sync/atomic"
 	"time"
 
-	"github.com/cespare/xxhash/v2"
 	"github.com/pkg/errors"
 
 	"github.com/go-kit/log"
 	"github.com/oklog/ulid"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
 	"github.com/prometheus/prometheus/storage"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
 	"github.com/thanos-io/thanosbench/pkg/seriesgen"
 )
 
@@ -25,43 +28,152 @@ type Writer interface {
 	// Flush writes current block to disk.
 	// The block will contain values accumulated by `Write`.
 	Flush() (ulid.ULID, error)
+
+	// Close releases resources of the writer and removes its temporary files, including data of block which was not
+	// flushed. It can be called after Flush.
+	Close() error
 }
 
-// TODO(bwplotka): Add option to create downsampled blocks.
+// BlockSpec describes block to generate. If Thanos.Downsample.Resolution is set, raw data from series is downsampled
+// to 5m or 1h resolution.
 type BlockSpec struct {
 	metadata.Meta
 	Series []SeriesSpec
+	// Seed changes values of all series, while keeping their labels. Specs with the same seed generate the same data.
+	Seed int64 `yaml:"seed"`
+	// Replica makes block one of HA replicas of the same stream.
+	Replica ReplicaSpec `yaml:"replica"`
+}
+
+// ReplicaSpec describes HA replica of a block stream.
+type ReplicaSpec struct {
+	// Label is the name of external label with replica name. Values of series are seeded without it, so all replicas
+	// have the same values, apart from differences configured by characteristics. If empty, block is not a replica.
+	Label string `yaml:"label"`
+
+	seriesgen.ReplicaCharacteristics `yaml:",inline"`
 }
 
 type GenType string
 
 const (
-	Random  GenType = "RANDOM"
-	Counter GenType = "COUNTER"
-	Gauge   GenType = "GAUGE"
+	Random          GenType = "RANDOM"
+	Counter         GenType = "COUNTER"
+	Gauge           GenType = "GAUGE"
+	Pattern         GenType = "PATTERN"
+	NativeHistogram GenType = "NATIVE_HISTOGRAM"
+
+	// ClassicHistogram and Summary generate whole metric families, so multiple series per target.
+	ClassicHistogram GenType = "HISTOGRAM"
+	Summary          GenType = "SUMMARY"
 )
 
 func (g GenType) Create(random *rand.Rand, mint, maxt int64, opts seriesgen.Characteristics) (seriesgen.SeriesIterator, error) {
 	switch g {
 	case Random:
-		return seriesgen.NewValGen(random, mint, maxt, opts), nil
+		return seriesgen.WithCharacteristics(random, seriesgen.NewValGen(random, mint, maxt, opts), mint, maxt, opts), nil
 	case Counter:
-		return seriesgen.NewCounterGen(random, mint, maxt, opts), nil
+		return seriesgen.WithCharacteristics(random, seriesgen.NewCounterGen(random, mint, maxt, opts), mint, maxt, opts), nil
 	case Gauge:
-		return seriesgen.NewGaugeGen(random, mint, maxt, opts), nil
+		return seriesgen.WithCharacteristics(random, seriesgen.NewGaugeGen(random, mint, maxt, opts), mint, maxt, opts), nil
+	case Pattern:
+		return seriesgen.WithCharacteristics(random, seriesgen.NewPatternGen(random, mint, maxt, opts), mint, maxt, opts), nil
+	case NativeHistogram:
+		if err := g.validateCharacteristics(opts); err != nil {
+			return nil, err
+		}
+		return seriesgen.NewHistogramGen(random, mint, maxt, opts), nil
 	default:
 		return nil, errors.Errorf("unknown type: %s", string(g))
 	}
 }
 
+// validateCharacteristics returns error if characteristics applied by seriesgen.WithCharacteristics are set for type
+// which does not support them. Native histograms and metric families are not wrapped, as wrappers yield float samples
+// only and would make series of a family disagree with each other.
+func (g GenType) validateCharacteristics(opts seriesgen.Characteristics) error {
+	for _, c := range []struct {
+		name string
+		set  bool
+	}{
+		{name: "special values", set: !reflect.DeepEqual(opts.SpecialValues, seriesgen.SpecialValueCharacteristics{})},
+		{name: "timestamps", set: opts.Timestamps != (seriesgen.TimestampCharacteristics{})},
+		{name: "gaps", set: opts.Gaps != (seriesgen.GapCharacteristics{})},
+		{name: "out-of-order", set: opts.OutOfOrder != (seriesgen.OutOfOrderCharacteristics{})},
+		{name: "exemplars", set: opts.Exemplars != (seriesgen.ExemplarCharacteristics{})},
+	} {
+		if c.set {
+			return errors.Errorf("%s characteristics are not supported by type %s", c.name, string(g))
+		}
+	}
+	return nil
+}
+
+// MetricType returns metric type of series generated by given type.
+func (g GenType) MetricType() textparse.MetricType {
+	switch g {
+	case Counter:
+		return textparse.MetricTypeCounter
+	case Random, Gauge, Pattern:
+		return textparse.MetricTypeGauge
+	case NativeHistogram, ClassicHistogram:
+		return textparse.MetricTypeHistogram
+	case Summary:
+		return textparse.MetricTypeSummary
+	default:
+		return textparse.MetricTypeUnknown
+	}
+}
+
+// FamilySize returns the number of series CreateSeries creates for a single set of labels.
+func (g GenType) FamilySize(opts seriesgen.Characteristics) int {
+	switch g {
+	case ClassicHistogram:
+		return seriesgen.ClassicHistogramFamilySize(opts)
+	case Summary:
+		return seriesgen.SummaryFamilySize(opts)
+	default:
+		return 1
+	}
+}
+
+// CreateSeries creates all series for given labels. It returns a whole metric family for family types
+// and a single series otherwise.
+func (g GenType) CreateSeries(seed int64, lset labels.Labels, mint, maxt int64, opts seriesgen.Characteristics) ([]seriesgen.Series, error) {
+	switch g {
+	case ClassicHistogram, Summary:
+		if err := g.validateCharacteristics(opts); err != nil {
+			return nil, err
+		}
+		if g == Summary {
+			return seriesgen.NewSummaryFamily(seed, lset, mint, maxt, opts)
+		}
+		return seriesgen.NewClassicHistogramFamily(seed, lset, mint, maxt, opts)
+	}
+
+	iter, err := g.Create(rand.New(rand.NewSource(seed)), mint, maxt, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []seriesgen.Series{seriesgen.NewSeriesGen(lset, iter)}, nil
+}
+
 type SeriesSpec struct {
 	Labels labels.Labels `yaml:"labels"`
 
 	// Targets multiples labels by given targets.
 	Targets int `yaml:"targets"`
+	// Cardinality generates labels of series from a model, merged with Labels. If set, Targets are ignored.
+	Cardinality seriesgen.CardinalityModel `yaml:"cardinality"`
 
 	Type GenType `yaml:"type"`
 
+	// Help and Unit are metric metadata appended together with samples. TYPE is derived from Type.
+	// If empty, generic help is used and unit is derived from the metric name suffix.
+	// NOTE: TSDB blocks do not persist metadata, it is kept only in the head and WAL.
+	Help string `yaml:"help"`
+	Unit string `yaml:"unit"`
+
 	MinTime, MaxTime int64
 
 	seriesgen.Characteristics `yaml:",inline"`
@@ -71,19 +183,78 @@ func durToMilis(t time.Duration) int64 {
 	return int64(t.Seconds() * 1000)
 }
 
+// NumSeries returns the number of series in the block generated from given spec.
+func (b BlockSpec) NumSeries() int {
+	n := 0
+	for _, s := range b.Series {
+		if len(s.Cardinality.Labels) > 0 {
+			n += s.Cardinality.NumSeries() * s.Type.FamilySize(s.Characteristics)
+			continue
+		}
+		n += s.Targets * s.Type.FamilySize(s.Characteristics)
+	}
+	return n
+}
+
 // Generate creates a block from given spec using given go routines in a given directory.
-func Generate(ctx context.Context, logger log.Logger, goroutines int, dir string, block BlockSpec) (ulid.ULID, error) {
-	w, err := NewTSDBBlockWriter(logger, dir)
-	if err != nil {
+// Append options, e.g. progress hook, are passed to seriesgen.Append.
+// The block has stable ID of the spec, see BlockSpec.ID, and is moved to the directory only when finished.
+func Generate(ctx context.Context, logger log.Logger, goroutines int, dir string, block BlockSpec, opts ...seriesgen.AppendOption) (ulid.ULID, error) {
+	var (
+		wopts    BlockWriterOptions
+		interval time.Duration
+		ooo      bool
+	)
+	for _, s := range block.Series {
+		if s.ScrapeInterval > interval {
+			interval = s.ScrapeInterval
+		}
+		if s.OutOfOrder.Probability > 0 {
+			ooo = true
+		}
+	}
+	if ooo {
+		// Head accepts out-of-order samples within the window from its newest sample of any series, which can be far
+		// ahead of delayed samples of other series once commits happen partway through appending, see
+		// seriesgen.WithCommitBatch. Window of the whole block range accepts all of them. Two scrape intervals are
+		// added, as samples can end up to one interval after MaxTime.
+		wopts.OutOfOrderTimeWindow = time.Duration(block.MaxTime-block.MinTime)*time.Millisecond + 2*interval
+	}
+	if err := validateResolution(block); err != nil {
 		return ulid.ULID{}, err
 	}
+	return generateStaged(ctx, logger, goroutines, dir, block, func(dir string) (Writer, error) {
+		return NewTSDBBlockWriter(logger, dir, wopts)
+	}, opts...)
+}
 
-	extLset := block.Thanos.Labels
-	if extLset == nil {
-		extLset = map[string]string{}
+// GenerateStreaming is like Generate, but uses StreamingBlockWriter, so memory does not grow with the number of
+// samples. Series with out-of-order samples are not supported.
+func GenerateStreaming(ctx context.Context, logger log.Logger, goroutines int, dir string, block BlockSpec, opts ...seriesgen.AppendOption) (ulid.ULID, error) {
+	for _, s := range block.Series {
+		if s.OutOfOrder.Probability > 0 {
+			return ulid.ULID{}, errors.Errorf("streaming writer does not support out-of-order samples, series %s", s.Labels)
+		}
+	}
+	if err := validateResolution(block); err != nil {
+		return ulid.ULID{}, err
 	}
-	set := &blockSeriesSet{config: block, extLset: labels.FromMap(extLset)}
-	if err := seriesgen.Append(ctx, goroutines, w, set); err != nil {
+	return generateStaged(ctx, logger, goroutines, dir, block, func(dir string) (Writer, error) {
+		return NewStreamingBlockWriter(logger, dir)
+	}, opts...)
+}
+
+// GenerateWithWriter creates a block from given spec using given writer, which writes blocks into given directory.
+// Writer is closed when done, so nothing but the finished block is left in the directory.
+func GenerateWithWriter(ctx context.Context, logger log.Logger, goroutines int, w Writer, dir string, block BlockSpec, opts ...seriesgen.AppendOption) (_ ulid.ULID, err error) {
+	defer runutil.CloseWithErrCapture(&err, w, "close writer")
+
+	if err := validateResolution(block); err != nil {
+		return ulid.ULID{}, err
+	}
+
+	appended := &sampleCounter{}
+	if err := seriesgen.Append(ctx, goroutines, w, newBlockSeriesSet(block), append(opts, seriesgen.WithProgressHook(appended))...); err != nil {
 		return ulid.ULID{}, errors.Wrap(err, "append")
 	}
 	id, err := w.Flush()
@@ -96,24 +267,88 @@ func Generate(ctx context.Context, logger log.Logger, goroutines int, dir string
 	if err != nil {
 		return ulid.ULID{}, errors.Wrap(err, "meta read")
 	}
+	// Head drops samples it does not accept on commit without error, so make sure block has all of them.
+	if n := atomic.LoadInt64(&appended.samples); int64(meta.Stats.NumSamples) != n {
+		return ulid.ULID{}, errors.Errorf("block %s has %d samples, %d were appended", id, meta.Stats.NumSamples, n)
+	}
 	meta.Thanos = block.Thanos
+	meta.Thanos.Downsample.Resolution = 0
+	// Compaction from spec makes block look compacted from other blocks, see Compacted.
+	if block.Compaction.Level > 0 {
+		meta.Compaction.Level = block.Compaction.Level
+	}
+	if len(block.Compaction.Sources) > 0 {
+		meta.Compaction.Sources = block.Compaction.Sources
+	}
+	meta.Compaction.Parents = block.Compaction.Parents
 	if err := meta.WriteToDir(logger, bdir); err != nil {
 		return ulid.ULID{}, errors.Wrap(err, "meta write")
 	}
-	return id, nil
+	if block.Thanos.Downsample.Resolution == 0 {
+		return id, nil
+	}
+	return downsampleBlock(logger, dir, id, block.Thanos.Downsample.Resolution)
+}
+
+// sampleCounter is a seriesgen.ProgressHook counting appended samples.
+type sampleCounter struct {
+	samples int64
+}
+
+func (c *sampleCounter) Appended(_, samples int) { atomic.AddInt64(&c.samples, int64(samples)) }
+
+// NewQueryable returns PromQL queryable storage with the same series as the block generated from given spec would have.
+// Series are generated into memory, no block is written.
+func NewQueryable(block BlockSpec) (*seriesgen.Queryable, error) {
+	return seriesgen.NewQueryable(newBlockSeriesSet(block))
 }
 
 type blockSeriesSet struct {
 	config  BlockSpec
 	extLset labels.Labels
-	i       int
-	target  int
-	err     error
+	// streamLset are external labels without replica label.
+	streamLset labels.Labels
+	i          int
+	target     int
+	err        error
 
 	curr seriesgen.Series
+	// pending are remaining series of the current metric family.
+	pending []seriesgen.Series
+	// cardinality are series of the current spec with cardinality model.
+	cardinality *seriesgen.CardinalitySet
+}
+
+func newBlockSeriesSet(block BlockSpec) *blockSeriesSet {
+	extLset := block.Thanos.Labels
+	if extLset == nil {
+		extLset = map[string]string{}
+	}
+	s := &blockSeriesSet{config: block, extLset: labels.FromMap(extLset)}
+	s.streamLset = s.extLset
+	if block.Replica.Label != "" {
+		s.streamLset = labels.NewBuilder(s.extLset).Del(block.Replica.Label).Labels(nil)
+	}
+	return s
 }
 
 func (s *blockSeriesSet) Next() bool {
+	if len(s.pending) > 0 {
+		s.curr, s.pending = s.pending[0], s.pending[1:]
+		return true
+	}
+
+	if s.cardinality != nil {
+		if s.cardinality.Next() {
+			s.curr = s.cardinality.At()
+			return true
+		}
+		if s.err = s.cardinality.Err(); s.err != nil {
+			return false
+		}
+		s.cardinality = nil
+	}
+
 	if s.target > 0 {
 		s.target--
 	}
@@ -123,39 +358,65 @@ func (s *blockSeriesSet) Next() bool {
 
 	if s.target <= 0 {
 		s.i++
-		s.target = s.config.Series[s.i-1].Targets
+		series := s.config.Series[s.i-1]
+		if len(series.Cardinality.Labels) > 0 {
+			// Cardinality model replaces targets.
+			s.cardinality = seriesgen.NewCardinalitySet(
+				rand.New(rand.NewSource(s.seed(series.Labels))),
+				series.Cardinality,
+				series.Labels,
+				func(lset labels.Labels) ([]seriesgen.Series, error) { return s.createSeries(series, lset) },
+			)
+			return s.Next()
+		}
+		s.target = series.Targets
 	}
 
 	series := s.config.Series[s.i-1]
 	lset := labels.Labels(append([]labels.Label{{Name: "__blockgen_target__", Value: fmt.Sprintf("%v", s.target)}}, series.Labels...))
-
-	b := make([]byte, 0, 1024)
-	for _, v := range lset {
-		b = append(b, v.Name...)
-		b = append(b, '\xff')
-		b = append(b, v.Value...)
-		b = append(b, '\xff')
-	}
-	for _, v := range s.extLset {
-		b = append(b, v.Name...)
-		b = append(b, '\xff')
-		b = append(b, v.Value...)
-		b = append(b, '\xff')
+	family, err := s.createSeries(series, lset)
+	if err != nil {
+		s.err = err
+		return false
 	}
+	s.curr, s.pending = family[0], family[1:]
+	return true
+}
+
+// seed returns stable random seed for given labels and external labels of the block, except replica label.
+func (s *blockSeriesSet) seed(lset labels.Labels) int64 {
+	return seriesgen.SeriesSeed(s.config.Seed, lset, s.streamLset)
+}
 
+func (s *blockSeriesSet) createSeries(series SeriesSpec, lset labels.Labels) ([]seriesgen.Series, error) {
 	// Stable random per series name.
-	iter, err := series.Type.Create(
-		rand.New(rand.NewSource(int64(xxhash.Sum64(b)))),
+	family, err := series.Type.CreateSeries(
+		s.seed(lset),
+		lset,
 		series.MinTime,
 		series.MaxTime,
 		series.Characteristics,
 	)
 	if err != nil {
-		s.err = err
-		return false
+		return nil, err
 	}
-	s.curr = seriesgen.NewSeriesGen(lset, iter)
-	return true
+	if s.config.Replica.Label != "" {
+		opts := s.config.Replica.ReplicaCharacteristics
+		if series.Type.MetricType() != textparse.MetricTypeGauge {
+			// Drift would break monotonicity of counters and consistency of histogram buckets.
+			opts.Drift = 0
+		}
+		for i, f := range family {
+			// Replica differences are seeded with replica label, so they are independent between replicas.
+			random := rand.New(rand.NewSource(seriesgen.SeriesSeed(s.config.Seed, f.Labels(), s.extLset)))
+			family[i] = seriesgen.NewSeriesGen(f.Labels(), seriesgen.WithReplica(random, f.Iterator(), series.MinTime, series.MaxTime, opts))
+		}
+	}
+	meta := seriesgen.NewMetadata(series.Type.MetricType(), lset, series.Help, series.Unit)
+	for i := range family {
+		family[i] = seriesgen.WithMetadata(family[i], meta)
+	}
+	return family, nil
 }
 
 func (s *blockSeriesSet) At() seriesgen.Series { return s.curr }
@@ -1 +1,317 @@
 package blockgen
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+func TestGenerate_NativeHistogram(t *testing.T) {
+	dir := t.TempDir()
+
+	maxt := durToMilis(2 * time.Hour)
+	id, err := Generate(context.Background(), log.NewNopLogger(), 2, dir, BlockSpec{
+		Meta: metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"cluster": "test"}},
+		},
+		Series: []SeriesSpec{{
+			Labels:  labels.FromStrings("__name__", "http_request_duration_seconds"),
+			Targets: 2,
+			Type:    NativeHistogram,
+			MinTime: 0,
+			MaxTime: maxt,
+			Characteristics: seriesgen.Characteristics{
+				ScrapeInterval: 15 * time.Second,
+				Min:            0.001,
+				Histogram: seriesgen.HistogramCharacteristics{
+					Schema:          2,
+					Buckets:         15,
+					ObservationRate: 10,
+				},
+			},
+		}},
+	})
+	testutil.Ok(t, err)
+
+	b, err := tsdb.OpenBlock(log.NewNopLogger(), filepath.Join(dir, id.String()), nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+	testutil.Equals(t, uint64(2), b.Meta().Stats.NumSeries)
+
+	q, err := tsdb.NewBlockQuerier(b, 0, maxt)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, q.Close()) }()
+
+	set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "http_request_duration_seconds"))
+	var samples int
+	for set.Next() {
+		it := set.At().Iterator()
+		for vt := it.Next(); vt != chunkenc.ValNone; vt = it.Next() {
+			testutil.Equals(t, chunkenc.ValHistogram, vt)
+			samples++
+		}
+		testutil.Ok(t, it.Err())
+	}
+	testutil.Ok(t, set.Err())
+	testutil.Equals(t, 2*int(maxt/durToMilis(15*time.Second)), samples)
+}
+
+func TestGenerate_OutOfOrder(t *testing.T) {
+	dir := t.TempDir()
+
+	maxt := durToMilis(2 * time.Hour)
+	id, err := Generate(context.Background(), log.NewNopLogger(), 2, dir, BlockSpec{
+		Meta: metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt}},
+		Series: []SeriesSpec{{
+			Labels:  labels.FromStrings("__name__", "up"),
+			Targets: 10,
+			Type:    Gauge,
+			MinTime: 0,
+			MaxTime: maxt,
+			Characteristics: seriesgen.Characteristics{
+				ScrapeInterval: 15 * time.Second,
+				Max:            1,
+				OutOfOrder:     seriesgen.OutOfOrderCharacteristics{Probability: 0.2, Window: 10 * time.Minute},
+			},
+		}},
+	})
+	testutil.Ok(t, err)
+
+	// Out-of-order samples are merged into a single block.
+	entries, err := os.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(entries))
+
+	b, err := tsdb.OpenBlock(log.NewNopLogger(), filepath.Join(dir, id.String()), nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+	testutil.Equals(t, uint64(10), b.Meta().Stats.NumSeries)
+	testutil.Equals(t, uint64(10*(maxt/durToMilis(15*time.Second)+1)), b.Meta().Stats.NumSamples)
+	testutil.Equals(t, 1, b.Meta().Compaction.Level)
+	testutil.Equals(t, []ulid.ULID{id}, b.Meta().Compaction.Sources)
+}
+
+func TestGenerate_OutOfOrderWithCommits(t *testing.T) {
+	maxt := durToMilis(2 * time.Hour)
+	spec := BlockSpec{
+		Meta: metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt}},
+		Series: []SeriesSpec{{
+			Labels:  labels.FromStrings("__name__", "up"),
+			Targets: 10,
+			Type:    Gauge,
+			MinTime: 0,
+			MaxTime: maxt,
+			Characteristics: seriesgen.Characteristics{
+				ScrapeInterval: 15 * time.Second,
+				Max:            1,
+				OutOfOrder:     seriesgen.OutOfOrderCharacteristics{Probability: 0.2, Window: 10 * time.Minute},
+			},
+		}},
+	}
+
+	// Commits partway through move the newest sample of the head ahead of delayed samples of other series.
+	for _, opt := range []seriesgen.AppendOption{
+		seriesgen.WithCommitBatch(0, 1),
+		seriesgen.WithCommitBatch(100, 0),
+		seriesgen.WithMaxPendingSamples(500),
+	} {
+		dir := t.TempDir()
+		id, err := Generate(context.Background(), log.NewNopLogger(), 2, dir, spec, opt)
+		testutil.Ok(t, err)
+
+		meta, err := metadata.ReadFromDir(filepath.Join(dir, id.String()))
+		testutil.Ok(t, err)
+		testutil.Equals(t, uint64(spec.NumSamples()), meta.Stats.NumSamples)
+	}
+}
+
+func TestGenType_UnsupportedCharacteristics(t *testing.T) {
+	lset := labels.FromStrings("__name__", "rpc_duration_seconds")
+	for _, g := range []GenType{NativeHistogram, ClassicHistogram, Summary} {
+		for _, opts := range []seriesgen.Characteristics{
+			{SpecialValues: seriesgen.SpecialValueCharacteristics{Probability: 0.1}},
+			{Timestamps: seriesgen.TimestampCharacteristics{Jitter: time.Millisecond}},
+			{Gaps: seriesgen.GapCharacteristics{MissedScrapeProbability: 0.1}},
+			{OutOfOrder: seriesgen.OutOfOrderCharacteristics{Probability: 0.1, Window: time.Minute}},
+			{Exemplars: seriesgen.ExemplarCharacteristics{Probability: 0.1}},
+		} {
+			opts.ScrapeInterval = 15 * time.Second
+			_, err := g.CreateSeries(1, lset, 0, durToMilis(time.Hour), opts)
+			testutil.NotOk(t, err)
+		}
+		_, err := g.CreateSeries(1, lset, 0, durToMilis(time.Hour), seriesgen.Characteristics{ScrapeInterval: 15 * time.Second})
+		testutil.Ok(t, err)
+	}
+}
+
+func TestGenerate_Cardinality(t *testing.T) {
+	maxt := durToMilis(2 * time.Hour)
+	spec := BlockSpec{
+		Meta: metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt}},
+		Series: []SeriesSpec{{
+			Labels: labels.FromStrings("__name__", "kube_pod_info"),
+			Cardinality: seriesgen.CardinalityModel{
+				Labels: []seriesgen.LabelModel{
+					{Name: "namespace", Values: 3},
+					{Name: "pod", Values: 10, Parent: "namespace"},
+					{Name: "node", Values: 5, Distribution: seriesgen.ZipfDistribution},
+				},
+				Series: 40,
+			},
+			Type:    Gauge,
+			MinTime: 0,
+			MaxTime: maxt,
+			Characteristics: seriesgen.Characteristics{
+				ScrapeInterval: 15 * time.Second,
+				Max:            1,
+			},
+		}},
+	}
+	testutil.Equals(t, 40, spec.NumSeries())
+
+	dir := t.TempDir()
+	id, err := Generate(context.Background(), log.NewNopLogger(), 2, dir, spec)
+	testutil.Ok(t, err)
+
+	b, err := tsdb.OpenBlock(log.NewNopLogger(), filepath.Join(dir, id.String()), nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+	testutil.Equals(t, uint64(40), b.Meta().Stats.NumSeries)
+
+	q, err := tsdb.NewBlockQuerier(b, 0, maxt)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, q.Close()) }()
+	names, _, err := q.LabelNames()
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"__name__", "namespace", "node", "pod"}, names)
+	namespaces, _, err := q.LabelValues("namespace")
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"namespace-0", "namespace-1", "namespace-2"}, namespaces)
+}
+
+func TestNewQueryable(t *testing.T) {
+	dir := t.TempDir()
+
+	maxt := durToMilis(2 * time.Hour)
+	spec := BlockSpec{
+		Meta: metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt}},
+		Series: []SeriesSpec{
+			{
+				Labels:  labels.FromStrings("__name__", "http_requests_total"),
+				Targets: 3,
+				Type:    Counter,
+				MinTime: 0,
+				MaxTime: maxt,
+				Characteristics: seriesgen.Characteristics{
+					ScrapeInterval: 15 * time.Second,
+					Max:            100,
+					Gaps:           seriesgen.GapCharacteristics{MissedScrapeProbability: 0.1},
+				},
+			},
+			{
+				Labels:  labels.FromStrings("__name__", "rpc_duration_seconds"),
+				Targets: 2,
+				Type:    Summary,
+				MinTime: 0,
+				MaxTime: maxt,
+				Characteristics: seriesgen.Characteristics{
+					ScrapeInterval: 30 * time.Second,
+					Histogram:      seriesgen.HistogramCharacteristics{ObservationRate: 5},
+				},
+			},
+		},
+	}
+	id, err := Generate(context.Background(), log.NewNopLogger(), 2, dir, spec)
+	testutil.Ok(t, err)
+	b, err := tsdb.OpenBlock(log.NewNopLogger(), filepath.Join(dir, id.String()), nil)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, b.Close()) }()
+	bq, err := tsdb.NewBlockQuerier(b, 0, maxt)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, bq.Close()) }()
+
+	queryable, err := NewQueryable(spec)
+	testutil.Ok(t, err)
+	q, err := queryable.Querier(context.Background(), 0, maxt)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, q.Close()) }()
+
+	// Queryable has exactly the same data as the generated block.
+	m := labels.MustNewMatcher(labels.MatchRegexp, "__name__", ".+")
+	expected := selectAll(t, bq.Select(true, nil, m))
+	testutil.Equals(t, 3+2*5, len(expected))
+	testutil.Equals(t, len(expected), spec.NumSeries())
+	testutil.Equals(t, expected, selectAll(t, q.Select(true, nil, m)))
+}
+
+func TestNewQueryable_Seed(t *testing.T) {
+	maxt := durToMilis(time.Hour)
+	spec := BlockSpec{
+		Meta: metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt}},
+		Series: []SeriesSpec{{
+			Labels:          labels.FromStrings("__name__", "up"),
+			Targets:         5,
+			Type:            Gauge,
+			MinTime:         0,
+			MaxTime:         maxt,
+			Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 100},
+		}},
+	}
+	selectSeed := func(seed int64) map[string][]string {
+		spec.Seed = seed
+		queryable, err := NewQueryable(spec)
+		testutil.Ok(t, err)
+		q, err := queryable.Querier(context.Background(), 0, maxt)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, q.Close()) }()
+		return selectAll(t, q.Select(true, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")))
+	}
+
+	expected := selectSeed(0)
+	testutil.Equals(t, 5, len(expected))
+	testutil.Equals(t, expected, selectSeed(0))
+
+	// Other seed keeps series, but changes their values.
+	got := selectSeed(1)
+	testutil.Equals(t, len(expected), len(got))
+	for lset, samples := range expected {
+		testutil.Assert(t, len(got[lset]) > 0, "missing series %v", lset)
+		testutil.Assert(t, samples[1] != got[lset][1], "expected different values of %v", lset)
+	}
+}
+
+func selectAll(t *testing.T, set storage.SeriesSet) map[string][]string {
+	t.Helper()
+
+	res := map[string][]string{}
+	for set.Next() {
+		it := set.At().Iterator()
+		for vt := it.Next(); vt != chunkenc.ValNone; vt = it.Next() {
+			if vt == chunkenc.ValHistogram {
+				ts, h := it.AtHistogram()
+				res[set.At().Labels().String()] = append(res[set.At().Labels().String()], fmt.Sprintf("%d %v", ts, h.String()))
+				continue
+			}
+			ts, v := it.At()
+			// Format to compare NaNs.
+			res[set.At().Labels().String()] = append(res[set.At().Labels().String()], fmt.Sprintf("%d %v", ts, v))
+		}
+		testutil.Ok(t, it.Err())
+	}
+	testutil.Ok(t, set.Err())
+	return res
+}
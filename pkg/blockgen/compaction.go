@@ -0,0 +1,145 @@
+package blockgen
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+// compactionRanges are default block ranges of Thanos compactor. Block of range up to compactionRanges[i] is of
+// compaction level i+1.
+var compactionRanges = []int64{
+	durToMilis(2 * time.Hour),
+	durToMilis(8 * time.Hour),
+	durToMilis(48 * time.Hour),
+	durToMilis(14 * 24 * time.Hour),
+}
+
+type OverlapType string
+
+const (
+	NoOverlap OverlapType = "none"
+	// VerticalOverlap is a 2h block overlapping the newest 2h of a block, with different sources. Thanos compactor
+	// needs vertical compaction to merge it.
+	VerticalOverlap OverlapType = "vertical"
+	// DuplicateOverlap is a 2h block with one of sources of the block it overlaps, as left behind when compactor
+	// fails to delete source blocks. Thanos compactor garbage collects it.
+	DuplicateOverlap OverlapType = "duplicate"
+)
+
+// compactionLevel returns compaction level of block of given range.
+func compactionLevel(r int64) int {
+	for i, cr := range compactionRanges {
+		if r <= cr {
+			return i + 1
+		}
+	}
+	return len(compactionRanges)
+}
+
+// sourceULID returns stable ULID of block of given compaction level starting at given time.
+func sourceULID(extLset labels.Labels, level int, t int64) ulid.ULID {
+	seed := seriesgen.SeriesSeed(t, extLset, labels.FromStrings("level", strconv.Itoa(level)))
+	return ulid.MustNew(uint64(t), rand.New(rand.NewSource(seed)))
+}
+
+// compaction returns compaction metadata of block with given range, as if it was compacted from 2h blocks.
+func compaction(extLset labels.Labels, mint, maxt int64) tsdb.BlockMetaCompaction {
+	c := tsdb.BlockMetaCompaction{Level: compactionLevel(maxt - mint)}
+	if c.Level == 1 {
+		return c
+	}
+
+	for t := mint; t <= maxt; t += compactionRanges[0] {
+		c.Sources = append(c.Sources, sourceULID(extLset, 1, t))
+	}
+	parentRange := compactionRanges[c.Level-2]
+	for t := mint; t <= maxt; t += parentRange {
+		pmaxt := t + parentRange - 1
+		if pmaxt > maxt {
+			pmaxt = maxt
+		}
+		c.Parents = append(c.Parents, tsdb.BlockDesc{ULID: sourceULID(extLset, c.Level-1, t), MinTime: t, MaxTime: pmaxt})
+	}
+	return c
+}
+
+// Compacted returns plan which sets compaction metadata of blocks of given plan as if Thanos compactor compacted
+// them from 2h blocks: compaction level from block range, a source ULID for each 2h of the block and parents
+// of the previous compaction range. Source and parent ULIDs are stable for given external labels of block and time.
+func Compacted(plan PlanFn) PlanFn {
+	return func(ctx context.Context, maxTime model.TimeOrDurationValue, extLset labels.Labels, blockEncoder func(BlockSpec) error) error {
+		return plan(ctx, maxTime, extLset, func(b BlockSpec) error {
+			b.Compaction = compaction(labels.FromMap(b.Thanos.Labels), b.MinTime, b.MaxTime)
+			return blockEncoder(b)
+		})
+	}
+}
+
+// Overlapping returns plan which, after every given number of raw blocks of given plan, emits a 2h block overlapping
+// the newest 2h of the block. Blocks of up to 2h are not overlapped, as the overlap would be the same spec, so the same
+// block. Duplicate overlaps are emitted only for blocks with multiple sources, see Compacted.
+func Overlapping(plan PlanFn, typ OverlapType, every int) PlanFn {
+	return func(ctx context.Context, maxTime model.TimeOrDurationValue, extLset labels.Labels, blockEncoder func(BlockSpec) error) error {
+		switch typ {
+		case NoOverlap, VerticalOverlap, DuplicateOverlap:
+		default:
+			return errors.Errorf("unknown overlap type %s", typ)
+		}
+		if every <= 0 {
+			return errors.Errorf("overlap every %d blocks, expected positive number", every)
+		}
+
+		n := 0
+		return plan(ctx, maxTime, extLset, func(b BlockSpec) error {
+			if err := blockEncoder(b); err != nil {
+				return err
+			}
+			if typ == NoOverlap || b.Thanos.Downsample.Resolution != 0 {
+				return nil
+			}
+			n++
+			if n%every != 0 || b.MaxTime-b.MinTime < compactionRanges[0] {
+				return nil
+			}
+
+			o := b
+			o.MinTime = b.MaxTime - compactionRanges[0] + 1
+			o.Series = clipSeries(b.Series, o.MinTime, o.MaxTime)
+			o.Compaction = tsdb.BlockMetaCompaction{Level: 1}
+			if typ == DuplicateOverlap {
+				if len(b.Compaction.Sources) < 2 {
+					return nil
+				}
+				o.Compaction.Sources = b.Compaction.Sources[len(b.Compaction.Sources)-1:]
+			}
+			return blockEncoder(o)
+		})
+	}
+}
+
+// clipSeries returns series specs limited to given time range.
+func clipSeries(series []SeriesSpec, mint, maxt int64) []SeriesSpec {
+	var clipped []SeriesSpec
+	for _, s := range series {
+		if s.MaxTime < mint || s.MinTime > maxt {
+			continue
+		}
+		if s.MinTime < mint {
+			s.MinTime = mint
+		}
+		if s.MaxTime > maxt {
+			s.MaxTime = maxt
+		}
+		clipped = append(clipped, s)
+	}
+	return clipped
+}
@@ -0,0 +1,139 @@
+package blockgen
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+	"gopkg.in/yaml.v2"
+)
+
+func TestCompaction(t *testing.T) {
+	extLset := labels.FromStrings("cluster", "one")
+	maxt := durToMilis(48 * time.Hour)
+
+	testutil.Equals(t, tsdb.BlockMetaCompaction{Level: 1}, compaction(extLset, maxt-durToMilis(2*time.Hour)+1, maxt))
+
+	c := compaction(extLset, maxt-durToMilis(8*time.Hour)+1, maxt)
+	testutil.Equals(t, 2, c.Level)
+	testutil.Equals(t, 4, len(c.Sources))
+	testutil.Equals(t, 4, len(c.Parents))
+	for i, p := range c.Parents {
+		// Parents of level 2 are the source blocks.
+		testutil.Equals(t, c.Sources[i], p.ULID)
+		testutil.Equals(t, durToMilis(2*time.Hour)-1, p.MaxTime-p.MinTime)
+	}
+
+	c = compaction(extLset, 1, maxt)
+	testutil.Equals(t, 3, c.Level)
+	testutil.Equals(t, 24, len(c.Sources))
+	testutil.Equals(t, 6, len(c.Parents))
+	testutil.Equals(t, int64(1), c.Parents[0].MinTime)
+	testutil.Equals(t, maxt, c.Parents[5].MaxTime)
+
+	// ULIDs are stable and depend on external labels.
+	testutil.Equals(t, c, compaction(extLset, 1, maxt))
+	testutil.Assert(t, c.Sources[0] != compaction(labels.FromStrings("cluster", "two"), 1, maxt).Sources[0])
+
+	// Sources survive block spec encoding.
+	b, err := yaml.Marshal(BlockSpec{Meta: metadata.Meta{BlockMeta: tsdb.BlockMeta{Compaction: c}}})
+	testutil.Ok(t, err)
+	decoded := BlockSpec{}
+	testutil.Ok(t, yaml.UnmarshalStrict(b, &decoded))
+	testutil.Equals(t, c.Sources, decoded.Compaction.Sources)
+	testutil.Equals(t, c.Parents, decoded.Compaction.Parents)
+}
+
+func TestOverlapping(t *testing.T) {
+	maxTime := model.TimeOrDurationValue{}
+	testutil.Ok(t, maxTime.Set("2020-01-01T00:00:00Z"))
+
+	plan := func(t *testing.T, planFn PlanFn) (blocks []BlockSpec) {
+		t.Helper()
+		testutil.Ok(t, planFn(context.Background(), maxTime, labels.FromStrings("a", "b"), func(b BlockSpec) error {
+			blocks = append(blocks, b)
+			return nil
+		}))
+		return blocks
+	}
+	raw := plan(t, Profiles["continuous-30d-tiny"])
+	testutil.Equals(t, 9, len(raw))
+
+	testutil.Equals(t, raw, plan(t, Overlapping(Profiles["continuous-30d-tiny"], NoOverlap, 1)))
+
+	t.Run("vertical", func(t *testing.T) {
+		blocks := plan(t, Overlapping(Profiles["continuous-30d-tiny"], VerticalOverlap, 4))
+		// Overlaps after 4th (8h) and 8th (176h) block.
+		testutil.Equals(t, 11, len(blocks))
+		for _, i := range []int{4, 9} {
+			o, b := blocks[i], blocks[i-1]
+			testutil.Equals(t, b.MaxTime, o.MaxTime)
+			testutil.Equals(t, durToMilis(2*time.Hour)-1, o.MaxTime-o.MinTime)
+			testutil.Equals(t, tsdb.BlockMetaCompaction{Level: 1}, o.Compaction)
+			for _, s := range o.Series {
+				testutil.Equals(t, o.MinTime, s.MinTime)
+				testutil.Equals(t, o.MaxTime, s.MaxTime)
+			}
+		}
+	})
+	t.Run("duplicate", func(t *testing.T) {
+		// 2h blocks have a single source, so they are not duplicated.
+		blocks := plan(t, Overlapping(Compacted(Profiles["continuous-30d-tiny"]), DuplicateOverlap, 1))
+		testutil.Equals(t, 14, len(blocks))
+		for i, b := range blocks {
+			if b.Compaction.Level == 1 || i+1 == len(blocks) {
+				continue
+			}
+			o := blocks[i+1]
+			testutil.Equals(t, 1, o.Compaction.Level)
+			testutil.Equals(t, []ulid.ULID{b.Compaction.Sources[len(b.Compaction.Sources)-1]}, o.Compaction.Sources)
+			testutil.Equals(t, b.MaxTime, o.MaxTime)
+		}
+	})
+	t.Run("downsampled copies are not overlapped", func(t *testing.T) {
+		blocks := plan(t, Overlapping(Profiles["continuous-30d-tiny-downsampled"], VerticalOverlap, 1))
+		overlapped := 0
+		for _, b := range raw {
+			// 2h blocks are not overlapped.
+			if b.MaxTime-b.MinTime >= durToMilis(2*time.Hour) {
+				overlapped++
+			}
+		}
+		testutil.Equals(t, 5, overlapped)
+		testutil.Equals(t, len(plan(t, Profiles["continuous-30d-tiny-downsampled"]))+overlapped, len(blocks))
+	})
+}
+
+func TestGenerate_Compaction(t *testing.T) {
+	maxt := durToMilis(8 * time.Hour)
+	c := compaction(labels.FromStrings("cluster", "one"), 1, maxt)
+
+	dir := t.TempDir()
+	id, err := Generate(context.Background(), log.NewNopLogger(), 2, dir, BlockSpec{
+		Meta: metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 1, MaxTime: maxt, Compaction: c}},
+		Series: []SeriesSpec{{
+			Labels:          labels.FromStrings("__name__", "up"),
+			Targets:         2,
+			Type:            Gauge,
+			MinTime:         1,
+			MaxTime:         maxt,
+			Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 100},
+		}},
+	})
+	testutil.Ok(t, err)
+
+	meta, err := metadata.ReadFromDir(filepath.Join(dir, id.String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, c.Level, meta.Compaction.Level)
+	testutil.Equals(t, c.Sources, meta.Compaction.Sources)
+	testutil.Equals(t, c.Parents, meta.Compaction.Parents)
+}
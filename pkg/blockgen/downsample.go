@@ -0,0 +1,62 @@
+package blockgen
+
+import (
+	"os"
+	"path"
+
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+)
+
+// validateResolution checks if block with given spec can be downsampled to its resolution.
+func validateResolution(block BlockSpec) error {
+	switch block.Thanos.Downsample.Resolution {
+	case 0:
+		return nil
+	case downsample.ResLevel1, downsample.ResLevel2:
+	default:
+		return errors.Errorf("unsupported resolution %d, expected 0, %d or %d", block.Thanos.Downsample.Resolution, downsample.ResLevel1, downsample.ResLevel2)
+	}
+	for _, s := range block.Series {
+		if s.Type == NativeHistogram {
+			return errors.Errorf("native histograms cannot be downsampled, series %s", s.Labels)
+		}
+	}
+	return nil
+}
+
+// downsampleBlock downsamples raw block in dir to given resolution in the same way Thanos compactor does, so 1h
+// resolution is downsampled from 5m one. Source blocks are removed.
+func downsampleBlock(logger log.Logger, dir string, id ulid.ULID, resolution int64) (ulid.ULID, error) {
+	for _, res := range []int64{downsample.ResLevel1, downsample.ResLevel2} {
+		if res > resolution {
+			break
+		}
+
+		bdir := path.Join(dir, id.String())
+		meta, err := metadata.ReadFromDir(bdir)
+		if err != nil {
+			return ulid.ULID{}, errors.Wrap(err, "meta read")
+		}
+		b, err := tsdb.OpenBlock(logger, bdir, downsample.NewPool())
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "open block %s", id)
+		}
+		newID, err := downsample.Downsample(logger, meta, b, dir, res)
+		if cerr := b.Close(); cerr != nil && err == nil {
+			err = errors.Wrapf(cerr, "close block %s", id)
+		}
+		if err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "downsample block %s to resolution %d", id, res)
+		}
+		if err := os.RemoveAll(bdir); err != nil {
+			return ulid.ULID{}, errors.Wrapf(err, "remove block %s", id)
+		}
+		id = newID
+	}
+	return id, nil
+}
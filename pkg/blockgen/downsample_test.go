@@ -0,0 +1,135 @@
+package blockgen
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+func TestGenerate_Downsampled(t *testing.T) {
+	maxt := durToMilis(48 * time.Hour)
+	spec := func(resolution int64) BlockSpec {
+		return BlockSpec{
+			Meta: metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt},
+				Thanos: metadata.Thanos{
+					Labels:     map[string]string{"cluster": "one"},
+					Downsample: metadata.ThanosDownsample{Resolution: resolution},
+				},
+			},
+			Series: []SeriesSpec{
+				{
+					Labels:          labels.FromStrings("__name__", "up"),
+					Targets:         2,
+					Type:            Gauge,
+					MinTime:         0,
+					MaxTime:         maxt,
+					Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 100},
+				},
+				{
+					Labels:          labels.FromStrings("__name__", "http_requests_total"),
+					Targets:         2,
+					Type:            Counter,
+					MinTime:         0,
+					MaxTime:         maxt,
+					Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 100},
+				},
+			},
+		}
+	}
+
+	rawDir := t.TempDir()
+	rawID, err := Generate(context.Background(), log.NewNopLogger(), 2, rawDir, spec(0))
+	testutil.Ok(t, err)
+	rawMeta, err := metadata.ReadFromDir(filepath.Join(rawDir, rawID.String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []ulid.ULID{rawID}, rawMeta.Compaction.Sources)
+
+	for _, resolution := range []int64{downsample.ResLevel1, downsample.ResLevel2} {
+		t.Run(time.Duration(resolution*int64(time.Millisecond)).String(), func(t *testing.T) {
+			dir := t.TempDir()
+			id, err := Generate(context.Background(), log.NewNopLogger(), 2, dir, spec(resolution))
+			testutil.Ok(t, err)
+			testutil.Assert(t, id != rawID, "expected different ID of downsampled block")
+
+			// Raw and intermediate blocks are removed.
+			entries, err := os.ReadDir(dir)
+			testutil.Ok(t, err)
+			testutil.Equals(t, 1, len(entries))
+
+			meta, err := metadata.ReadFromDir(filepath.Join(dir, id.String()))
+			testutil.Ok(t, err)
+			testutil.Equals(t, resolution, meta.Thanos.Downsample.Resolution)
+			testutil.Equals(t, map[string]string{"cluster": "one"}, meta.Thanos.Labels)
+			testutil.Equals(t, uint64(4), meta.Stats.NumSeries)
+			// Downsampled blocks have sources of the raw block, as if Thanos compactor downsampled it.
+			testutil.Equals(t, rawMeta.Compaction.Sources, meta.Compaction.Sources)
+
+			b, err := tsdb.OpenBlock(log.NewNopLogger(), filepath.Join(dir, id.String()), downsample.NewPool())
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, b.Close()) }()
+			ir, err := b.Index()
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, ir.Close()) }()
+			cr, err := b.Chunks()
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, cr.Close()) }()
+
+			p, err := ir.Postings(index.AllPostingsKey())
+			testutil.Ok(t, err)
+			for p.Next() {
+				var (
+					lset labels.Labels
+					chks []chunks.Meta
+				)
+				testutil.Ok(t, ir.Series(p.At(), &lset, &chks))
+				testutil.Assert(t, len(chks) > 0)
+				for _, c := range chks {
+					chk, err := cr.Chunk(c)
+					testutil.Ok(t, err)
+					ac, ok := chk.(*downsample.AggrChunk)
+					testutil.Assert(t, ok, "expected aggregated chunk, got %T", chk)
+					for _, typ := range []downsample.AggrType{downsample.AggrCount, downsample.AggrSum, downsample.AggrMin, downsample.AggrMax, downsample.AggrCounter} {
+						_, err := ac.Get(typ)
+						testutil.Ok(t, err)
+					}
+				}
+			}
+			testutil.Ok(t, p.Err())
+		})
+	}
+
+	t.Run("unsupported resolution", func(t *testing.T) {
+		_, err := Generate(context.Background(), log.NewNopLogger(), 2, t.TempDir(), spec(1000))
+		testutil.NotOk(t, err)
+	})
+}
+
+func TestDownsampled(t *testing.T) {
+	maxTime := model.TimeOrDurationValue{}
+	testutil.Ok(t, maxTime.Set("2020-01-01T00:00:00Z"))
+
+	resolutions := map[int64]int{}
+	testutil.Ok(t, Profiles["continuous-365d-tiny-downsampled"](context.Background(), maxTime, labels.FromStrings("a", "b"), func(b BlockSpec) error {
+		resolutions[b.Thanos.Downsample.Resolution]++
+		testutil.Assert(t, b.MaxTime <= timestamp.FromTime(time.Date(2020, 1, 1, 2, 0, 0, 0, time.UTC)))
+		return nil
+	}))
+	// 13 raw blocks, 9 of at least 40h and 5 of at least 10d.
+	testutil.Equals(t, map[int64]int{0: 13, downsample.ResLevel1: 9, downsample.ResLevel2: 5}, resolutions)
+}
@@ -0,0 +1,163 @@
+package blockgen
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/oklog/ulid"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// Rough memory used by a single series in the head, including labels, postings and open chunks.
+	headSeriesBytes = 8 * 1024
+	// Rough memory used by a single appended sample before it is compacted into a block.
+	headSampleBytes = 64
+	// Rough memory used by a single series in the streaming writer, including open chunk and unspilled chunk metas.
+	streamingSeriesBytes = 4 * 1024
+)
+
+// NumSamples returns the approximate number of samples in the block generated from given spec, ignoring gaps
+// and timestamp irregularities.
+func (b BlockSpec) NumSamples() int64 {
+	var n int64
+	for _, s := range b.Series {
+		interval := s.ScrapeInterval.Milliseconds()
+		if interval <= 0 || s.MaxTime <= s.MinTime {
+			continue
+		}
+		series := BlockSpec{Series: []SeriesSpec{s}}.NumSeries()
+		n += int64(series) * ((s.MaxTime-s.MinTime)/interval + 1)
+	}
+	return n
+}
+
+// HeadMemoryEstimate returns rough memory in bytes needed by Generate for given spec.
+func HeadMemoryEstimate(b BlockSpec) int64 {
+	return int64(b.NumSeries())*headSeriesBytes + b.NumSamples()*headSampleBytes
+}
+
+// StreamingMemoryEstimate returns rough memory in bytes needed by GenerateStreaming for given spec.
+func StreamingMemoryEstimate(b BlockSpec) int64 {
+	return int64(b.NumSeries()) * streamingSeriesBytes
+}
+
+// PipelineOptions configures GeneratePipeline.
+type PipelineOptions struct {
+	// Concurrency is the maximum number of blocks generated at the same time. If 0, blocks are generated one by one.
+	Concurrency int
+	// MemoryBudget is the maximum sum of estimated memory in bytes of blocks generated at the same time.
+	// Block estimated above the budget is generated alone. If 0, there is no limit.
+	MemoryBudget int64
+	// MemoryEstimate returns estimated memory in bytes needed to generate given block. Required if MemoryBudget is set.
+	MemoryEstimate func(BlockSpec) int64
+}
+
+// GeneratePipeline generates blocks returned by next until it returns io.EOF. Independent blocks are generated
+// concurrently within limits from options. Each generated block is passed to upload, which runs in its own go routine,
+// so a block is uploaded while the next ones are generated. Blocks are uploaded one by one in order of finished
+// generation; generation waits if uploads fall behind. Upload can be nil. On the first error, other generations are
+// cancelled, so generate has to remove what it wrote on error, as Generate and GenerateStreaming do by closing their
+// writers.
+func GeneratePipeline(
+	ctx context.Context,
+	next func() (BlockSpec, error),
+	generate func(context.Context, BlockSpec) (ulid.ULID, error),
+	upload func(context.Context, ulid.ULID) error,
+	opts PipelineOptions,
+) error {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	g, gctx := errgroup.WithContext(ctx)
+
+	uploads := make(chan ulid.ULID, concurrency)
+	g.Go(func() error {
+		for id := range uploads {
+			if upload == nil {
+				continue
+			}
+			if err := upload(gctx, id); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	var (
+		slots  = semaphore.NewWeighted(int64(concurrency))
+		memory *semaphore.Weighted
+		wg     sync.WaitGroup
+	)
+	if opts.MemoryBudget > 0 {
+		memory = semaphore.NewWeighted(opts.MemoryBudget)
+	}
+
+	// schedule returns only errors of next. Other errors cancel the group and are returned by its Wait.
+	schedule := func() error {
+		for {
+			b, err := next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := slots.Acquire(gctx, 1); err != nil {
+				return nil
+			}
+			var weight int64
+			if memory != nil {
+				weight = opts.MemoryEstimate(b)
+				if weight > opts.MemoryBudget {
+					weight = opts.MemoryBudget
+				}
+				if err := memory.Acquire(gctx, weight); err != nil {
+					slots.Release(1)
+					return nil
+				}
+			}
+
+			wg.Add(1)
+			g.Go(func() error {
+				defer wg.Done()
+				defer slots.Release(1)
+				if memory != nil {
+					defer memory.Release(weight)
+				}
+
+				id, err := generate(gctx, b)
+				if err != nil {
+					return err
+				}
+				select {
+				case uploads <- id:
+					return nil
+				case <-gctx.Done():
+					return gctx.Err()
+				}
+			})
+		}
+	}
+
+	err := schedule()
+	if err != nil {
+		cancel()
+	}
+	wg.Wait()
+	close(uploads)
+	if gerr := g.Wait(); err == nil {
+		err = gerr
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
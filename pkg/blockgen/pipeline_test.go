@@ -0,0 +1,160 @@
+package blockgen
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+func TestBlockSpec_NumSamples(t *testing.T) {
+	b := BlockSpec{Series: []SeriesSpec{
+		{
+			Labels:          labels.FromStrings("__name__", "a"),
+			Targets:         2,
+			Type:            Gauge,
+			MinTime:         0,
+			MaxTime:         durToMilis(1 * time.Hour),
+			Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second},
+		},
+		{
+			Labels:  labels.FromStrings("__name__", "b"),
+			Targets: 3,
+			Type:    Gauge,
+			MinTime: 0,
+			MaxTime: durToMilis(1 * time.Hour),
+		},
+	}}
+	testutil.Equals(t, int64(2*241), b.NumSamples())
+	testutil.Equals(t, int64(5*headSeriesBytes+2*241*headSampleBytes), HeadMemoryEstimate(b))
+	testutil.Equals(t, int64(5*streamingSeriesBytes), StreamingMemoryEstimate(b))
+}
+
+func TestGeneratePipeline(t *testing.T) {
+	specs := func(n int) func() (BlockSpec, error) {
+		i := 0
+		return func() (BlockSpec, error) {
+			if i == n {
+				return BlockSpec{}, io.EOF
+			}
+			i++
+			return BlockSpec{Meta: metadata.Meta{BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(uint64(i), nil)}}}, nil
+		}
+	}
+
+	// tracker records the maximum number of concurrently generated blocks.
+	type tracker struct {
+		mtx          sync.Mutex
+		running, max int
+		uploaded     []ulid.ULID
+	}
+	generate := func(tr *tracker) func(context.Context, BlockSpec) (ulid.ULID, error) {
+		return func(_ context.Context, b BlockSpec) (ulid.ULID, error) {
+			tr.mtx.Lock()
+			tr.running++
+			if tr.running > tr.max {
+				tr.max = tr.running
+			}
+			tr.mtx.Unlock()
+
+			time.Sleep(10 * time.Millisecond)
+
+			tr.mtx.Lock()
+			tr.running--
+			tr.mtx.Unlock()
+			return b.ULID, nil
+		}
+	}
+	upload := func(tr *tracker) func(context.Context, ulid.ULID) error {
+		return func(_ context.Context, id ulid.ULID) error {
+			tr.mtx.Lock()
+			defer tr.mtx.Unlock()
+			tr.uploaded = append(tr.uploaded, id)
+			return nil
+		}
+	}
+	uploaded := func(tr *tracker) []uint64 {
+		var ts []uint64
+		for _, id := range tr.uploaded {
+			ts = append(ts, id.Time())
+		}
+		sort.Slice(ts, func(i, j int) bool { return ts[i] < ts[j] })
+		return ts
+	}
+
+	for _, tcase := range []struct {
+		name        string
+		opts        PipelineOptions
+		expectedMax int
+	}{
+		{name: "sequential", expectedMax: 1},
+		{name: "concurrent", opts: PipelineOptions{Concurrency: 3}, expectedMax: 3},
+		{
+			name:        "memory budget",
+			opts:        PipelineOptions{Concurrency: 3, MemoryBudget: 10, MemoryEstimate: func(BlockSpec) int64 { return 5 }},
+			expectedMax: 2,
+		},
+		{
+			name:        "block above memory budget",
+			opts:        PipelineOptions{Concurrency: 3, MemoryBudget: 10, MemoryEstimate: func(BlockSpec) int64 { return 100 }},
+			expectedMax: 1,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			tr := &tracker{}
+			testutil.Ok(t, GeneratePipeline(context.Background(), specs(6), generate(tr), upload(tr), tcase.opts))
+			testutil.Equals(t, tcase.expectedMax, tr.max)
+			testutil.Equals(t, []uint64{1, 2, 3, 4, 5, 6}, uploaded(tr))
+		})
+	}
+
+	t.Run("no upload", func(t *testing.T) {
+		tr := &tracker{}
+		testutil.Ok(t, GeneratePipeline(context.Background(), specs(3), generate(tr), nil, PipelineOptions{Concurrency: 2}))
+		testutil.Equals(t, 2, tr.max)
+	})
+
+	t.Run("generate error", func(t *testing.T) {
+		err := GeneratePipeline(context.Background(), specs(6), func(_ context.Context, b BlockSpec) (ulid.ULID, error) {
+			if b.ULID.Time() == 2 {
+				return ulid.ULID{}, errors.New("generate failed")
+			}
+			return b.ULID, nil
+		}, nil, PipelineOptions{Concurrency: 2})
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "generate failed", err.Error())
+	})
+
+	t.Run("upload error", func(t *testing.T) {
+		tr := &tracker{}
+		err := GeneratePipeline(context.Background(), specs(6), generate(tr), func(context.Context, ulid.ULID) error {
+			return errors.New("upload failed")
+		}, PipelineOptions{Concurrency: 2})
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "upload failed", err.Error())
+	})
+
+	t.Run("next error", func(t *testing.T) {
+		tr := &tracker{}
+		next := specs(2)
+		err := GeneratePipeline(context.Background(), func() (BlockSpec, error) {
+			b, err := next()
+			if err == io.EOF {
+				return b, errors.New("decode failed")
+			}
+			return b, err
+		}, generate(tr), upload(tr), PipelineOptions{Concurrency: 2})
+		testutil.NotOk(t, err)
+		testutil.Equals(t, "decode failed", err.Error())
+	})
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
 	"github.com/thanos-io/thanos/pkg/model"
 	"github.com/thanos-io/thanosbench/pkg/seriesgen"
 )
@@ -120,6 +121,34 @@ var (
 			67 * 24 * time.Hour,
 			67 * 24 * time.Hour,
 		}, 1, 5),
+		"continuous-30d-tiny-downsampled": Downsampled(continuous([]time.Duration{
+			// 30 days, from newest to oldest, with downsampled copies of blocks as Thanos compactor would create.
+			2 * time.Hour,
+			2 * time.Hour,
+			2 * time.Hour,
+			8 * time.Hour,
+			176 * time.Hour,
+			176 * time.Hour,
+			176 * time.Hour,
+			176 * time.Hour,
+			2 * time.Hour,
+		}, 1, 5)),
+		"continuous-365d-tiny-downsampled": Downsampled(continuous([]time.Duration{
+			// 1y days, from newest to oldest, with downsampled copies of blocks as Thanos compactor would create.
+			2 * time.Hour,
+			2 * time.Hour,
+			2 * time.Hour,
+			8 * time.Hour,
+			176 * time.Hour,
+			176 * time.Hour,
+			176 * time.Hour,
+			176 * time.Hour,
+			67 * 24 * time.Hour,
+			67 * 24 * time.Hour,
+			67 * 24 * time.Hour,
+			67 * 24 * time.Hour,
+			67 * 24 * time.Hour,
+		}, 1, 5)),
 		"continuous-1w-1series-10000apps": continuous([]time.Duration{
 			// One week, from newest to oldest, in the same way Thanos compactor would do.
 			2 * time.Hour,
@@ -281,6 +310,35 @@ func continuous(ranges []time.Duration, apps int, metricsPerApp int) PlanFn {
 	}
 }
 
+// Downsampled returns plan which emits blocks of given plan together with their downsampled copies, in the same way
+// Thanos compactor creates them: 5m resolution for blocks of at least 40h and 1h resolution for blocks of at least 10d.
+func Downsampled(plan PlanFn) PlanFn {
+	return func(ctx context.Context, maxTime model.TimeOrDurationValue, extLset labels.Labels, blockEncoder func(BlockSpec) error) error {
+		return plan(ctx, maxTime, extLset, func(b BlockSpec) error {
+			if err := blockEncoder(b); err != nil {
+				return err
+			}
+			if b.Thanos.Downsample.Resolution != 0 {
+				return nil
+			}
+			for _, res := range []struct{ resolution, minRange int64 }{
+				{resolution: downsample.ResLevel1, minRange: downsample.ResLevel1DownsampleRange},
+				{resolution: downsample.ResLevel2, minRange: downsample.ResLevel2DownsampleRange},
+			} {
+				if b.MaxTime-b.MinTime < res.minRange {
+					break
+				}
+				d := b
+				d.Thanos.Downsample.Resolution = res.resolution
+				if err := blockEncoder(d); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+}
+
 func rangeForTimestamp(t int64, width int64) (maxt int64) {
 	return (t/width)*width + width
 }
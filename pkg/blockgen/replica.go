@@ -0,0 +1,61 @@
+package blockgen
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+// ReplicaOptions configures Replicated plan.
+type ReplicaOptions struct {
+	// Replicas is the number of HA replicas.
+	Replicas int
+	// Label is the name of external label with replica index.
+	Label string
+	// Offset shifts timestamps of replicas, replica i has timestamps shifted by i * Offset.
+	Offset time.Duration
+	// Drift and Gaps are characteristics of each replica, see seriesgen.ReplicaCharacteristics.
+	Drift float64
+	Gaps  seriesgen.GapCharacteristics
+}
+
+// Replicated returns plan which emits all blocks of given plan for each of HA replicas, with replica label added
+// to external labels. Replicas have the same series and values, apart from timestamp offsets, value drift and
+// independent gaps.
+func Replicated(plan PlanFn, opts ReplicaOptions) PlanFn {
+	return func(ctx context.Context, maxTime model.TimeOrDurationValue, extLset labels.Labels, blockEncoder func(BlockSpec) error) error {
+		if opts.Replicas <= 0 {
+			return errors.Errorf("replicas have to be positive, got %d", opts.Replicas)
+		}
+		if opts.Label == "" {
+			return errors.New("replica label cannot be empty")
+		}
+		if extLset.Has(opts.Label) {
+			return errors.Errorf("replica label %s is already in external labels", opts.Label)
+		}
+
+		for i := 0; i < opts.Replicas; i++ {
+			replica := ReplicaSpec{
+				Label: opts.Label,
+				ReplicaCharacteristics: seriesgen.ReplicaCharacteristics{
+					Offset: time.Duration(i) * opts.Offset,
+					Drift:  opts.Drift,
+					Gaps:   opts.Gaps,
+				},
+			}
+			lset := labels.NewBuilder(extLset).Set(opts.Label, strconv.Itoa(i)).Labels(nil)
+			if err := plan(ctx, maxTime, lset, func(b BlockSpec) error {
+				b.Replica = replica
+				return blockEncoder(b)
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
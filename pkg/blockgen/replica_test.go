@@ -0,0 +1,112 @@
+package blockgen
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/model"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+func TestReplicated(t *testing.T) {
+	maxTime := model.TimeOrDurationValue{}
+	testutil.Ok(t, maxTime.Set("2020-01-01T00:00:00Z"))
+
+	var blocks []BlockSpec
+	testutil.Ok(t, Replicated(Profiles["continuous-30d-tiny"], ReplicaOptions{Replicas: 3, Label: "replica", Offset: time.Second, Drift: 0.01})(
+		context.Background(), maxTime, labels.FromStrings("cluster", "one"), func(b BlockSpec) error {
+			blocks = append(blocks, b)
+			return nil
+		}))
+	testutil.Equals(t, 27, len(blocks))
+	for i, b := range blocks {
+		replica := i / 9
+		testutil.Equals(t, map[string]string{"cluster": "one", "replica": strconv.Itoa(replica)}, b.Thanos.Labels)
+		testutil.Equals(t, "replica", b.Replica.Label)
+		testutil.Equals(t, time.Duration(replica)*time.Second, b.Replica.Offset)
+		testutil.Equals(t, 0.01, b.Replica.Drift)
+		testutil.Equals(t, blocks[i%9].MinTime, b.MinTime)
+	}
+
+	testutil.NotOk(t, Replicated(Profiles["continuous-30d-tiny"], ReplicaOptions{Replicas: 2, Label: "cluster"})(
+		context.Background(), maxTime, labels.FromStrings("cluster", "one"), func(BlockSpec) error { return nil }))
+}
+
+func TestNewQueryable_Replica(t *testing.T) {
+	maxt := durToMilis(time.Hour)
+	spec := func(replica int, opts seriesgen.ReplicaCharacteristics) BlockSpec {
+		return BlockSpec{
+			Meta: metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt},
+				Thanos:    metadata.Thanos{Labels: map[string]string{"cluster": "one", "replica": strconv.Itoa(replica)}},
+			},
+			Replica: ReplicaSpec{Label: "replica", ReplicaCharacteristics: opts},
+			Series: []SeriesSpec{
+				{
+					Labels:          labels.FromStrings("__name__", "gauge"),
+					Targets:         2,
+					Type:            Gauge,
+					MinTime:         0,
+					MaxTime:         maxt,
+					Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 100, Min: 10},
+				},
+				{
+					Labels:          labels.FromStrings("__name__", "counter"),
+					Targets:         2,
+					Type:            Counter,
+					MinTime:         0,
+					MaxTime:         maxt,
+					Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 100, Min: 10},
+				},
+			},
+		}
+	}
+	selectAllReplica := func(b BlockSpec) map[string][]string {
+		queryable, err := NewQueryable(b)
+		testutil.Ok(t, err)
+		q, err := queryable.Querier(context.Background(), 0, maxt)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, q.Close()) }()
+		return selectAll(t, q.Select(true, nil, labels.MustNewMatcher(labels.MatchRegexp, "__name__", ".+")))
+	}
+
+	first := selectAllReplica(spec(0, seriesgen.ReplicaCharacteristics{}))
+	testutil.Equals(t, 4, len(first))
+
+	// Without differences replicas have the same samples.
+	testutil.Equals(t, first, selectAllReplica(spec(1, seriesgen.ReplicaCharacteristics{})))
+
+	second := selectAllReplica(spec(1, seriesgen.ReplicaCharacteristics{Offset: time.Second, Drift: 0.01}))
+	testutil.Equals(t, len(first), len(second))
+	for lset, samples := range first {
+		// Series of both replicas have the same labels, replica label is only external.
+		got, ok := second[lset]
+		testutil.Assert(t, ok, "missing series %v", lset)
+		testutil.Equals(t, len(samples)-1, len(got))
+
+		ts, v := splitSample(t, samples[0])
+		gotTs, gotV := splitSample(t, got[0])
+		testutil.Equals(t, ts+1000, gotTs)
+		if strings.Contains(lset, "counter") {
+			testutil.Equals(t, v, gotV)
+			continue
+		}
+		testutil.Assert(t, v != gotV, "expected drifted value of %v", lset)
+	}
+}
+
+func splitSample(t *testing.T, s string) (int64, string) {
+	t.Helper()
+
+	parts := strings.SplitN(s, " ", 2)
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	testutil.Ok(t, err)
+	return ts, parts[1]
+}
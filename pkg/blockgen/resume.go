@@ -0,0 +1,158 @@
+package blockgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// specHashHint is prefix of compaction hint with hash of the spec block was generated from. Hints are kept
+	// in meta.json on upload, unlike unknown fields.
+	specHashHint = "blockgen-spec-sha256="
+	// stagingDirPrefix is prefix of directories where blocks are generated before being moved to output directory.
+	stagingDirPrefix = "blockgen-staging-"
+)
+
+// Hash returns content hash of spec, hex encoded SHA-256 of its YAML.
+func (b BlockSpec) Hash() (string, error) {
+	out, err := yaml.Marshal(b)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal spec")
+	}
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ID returns stable ULID of block generated from spec. Its time is MaxTime of spec and entropy is taken from Hash,
+// so the same spec always has the same ID.
+func (b BlockSpec) ID() (ulid.ULID, error) {
+	hash, err := b.Hash()
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	entropy, err := hex.DecodeString(hash)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "decode hash")
+	}
+	t := b.MaxTime
+	if t < 0 {
+		t = 0
+	}
+	return ulid.New(uint64(t), bytes.NewReader(entropy))
+}
+
+// SpecHash returns hash of spec given block was generated from. It returns false for blocks not generated by blockgen.
+func SpecHash(meta *metadata.Meta) (string, bool) {
+	for _, h := range meta.Compaction.Hints {
+		if strings.HasPrefix(h, specHashHint) {
+			return strings.TrimPrefix(h, specHashHint), true
+		}
+	}
+	return "", false
+}
+
+// generateStaged generates block with writer created in a staging directory and moves the finished block into dir,
+// under the ID of spec and with spec hash in meta. Staging directory is removed on error and cancellation, so dir
+// never has partial blocks. Block already generated from the same spec is replaced.
+func generateStaged(
+	ctx context.Context,
+	logger log.Logger,
+	goroutines int,
+	dir string,
+	block BlockSpec,
+	newWriter func(dir string) (Writer, error),
+	opts ...seriesgen.AppendOption,
+) (_ ulid.ULID, err error) {
+	hash, err := block.Hash()
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	id, err := block.ID()
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "block ID")
+	}
+
+	staging := filepath.Join(dir, stagingDirPrefix+id.String())
+	if err := os.RemoveAll(staging); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "remove staging dir")
+	}
+	defer func() {
+		if rerr := os.RemoveAll(staging); rerr != nil && err == nil {
+			err = errors.Wrap(rerr, "remove staging dir")
+		}
+	}()
+
+	w, err := newWriter(staging)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+	stagedID, err := GenerateWithWriter(ctx, logger, goroutines, w, staging, block, opts...)
+	if err != nil {
+		return ulid.ULID{}, err
+	}
+
+	bdir := filepath.Join(staging, stagedID.String())
+	meta, err := metadata.ReadFromDir(bdir)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "meta read")
+	}
+	meta.ULID = id
+	if len(block.Compaction.Sources) == 0 {
+		// Downsampled block has sources of the raw block it was downsampled from, as downsample.Downsample keeps them,
+		// so Thanos compactor does not downsample it again.
+		raw := block
+		raw.Thanos.Downsample.Resolution = 0
+		rawID, err := raw.ID()
+		if err != nil {
+			return ulid.ULID{}, errors.Wrap(err, "raw block ID")
+		}
+		meta.Compaction.Sources = []ulid.ULID{rawID}
+	}
+	meta.Compaction.Hints = append(meta.Compaction.Hints, specHashHint+hash)
+	if err := meta.WriteToDir(logger, bdir); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "meta write")
+	}
+
+	dst := filepath.Join(dir, id.String())
+	if err := os.RemoveAll(dst); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "remove previous block")
+	}
+	if err := os.Rename(bdir, dst); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "move block")
+	}
+	return id, nil
+}
+
+// RemovePartial removes staging directories left in dir by generation which was killed before it could clean up.
+func RemovePartial(logger log.Logger, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "read dir")
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !strings.HasPrefix(e.Name(), stagingDirPrefix) {
+			continue
+		}
+		level.Info(logger).Log("msg", "removing partially generated block", "path", filepath.Join(dir, e.Name()))
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return errors.Wrapf(err, "remove %s", e.Name())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package blockgen
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+func TestGenerate_Resumable(t *testing.T) {
+	maxt := durToMilis(2 * time.Hour)
+	spec := BlockSpec{
+		Meta: metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"cluster": "one"}},
+		},
+		Series: []SeriesSpec{{
+			Labels:          labels.FromStrings("__name__", "up"),
+			Targets:         10,
+			Type:            Gauge,
+			MinTime:         0,
+			MaxTime:         maxt,
+			Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 1},
+		}},
+	}
+	hash, err := spec.Hash()
+	testutil.Ok(t, err)
+	expectedID, err := spec.ID()
+	testutil.Ok(t, err)
+	testutil.Equals(t, uint64(maxt), expectedID.Time())
+
+	other := spec
+	other.Seed = 1
+	otherID, err := other.ID()
+	testutil.Ok(t, err)
+	testutil.Assert(t, expectedID != otherID, "expected different IDs of different specs")
+
+	dir := t.TempDir()
+	for _, generate := range []func(context.Context, log.Logger, int, string, BlockSpec, ...seriesgen.AppendOption) (ulid.ULID, error){
+		Generate,
+		GenerateStreaming,
+		// Generating again replaces the block.
+		Generate,
+	} {
+		id, err := generate(context.Background(), log.NewNopLogger(), 2, dir, spec)
+		testutil.Ok(t, err)
+		testutil.Equals(t, expectedID, id)
+
+		entries, err := os.ReadDir(dir)
+		testutil.Ok(t, err)
+		testutil.Equals(t, 1, len(entries))
+
+		meta, err := metadata.ReadFromDir(filepath.Join(dir, id.String()))
+		testutil.Ok(t, err)
+		testutil.Equals(t, id, meta.ULID)
+		testutil.Equals(t, []ulid.ULID{id}, meta.Compaction.Sources)
+		metaHash, ok := SpecHash(meta)
+		testutil.Assert(t, ok, "expected spec hash in meta")
+		testutil.Equals(t, hash, metaHash)
+	}
+
+	// Cancelled generation leaves no partial output.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = Generate(ctx, log.NewNopLogger(), 2, dir, other)
+	testutil.NotOk(t, err)
+	entries, err := os.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(entries))
+	testutil.Equals(t, expectedID.String(), entries[0].Name())
+}
+
+func TestRemovePartial(t *testing.T) {
+	dir := t.TempDir()
+	id := ulid.MustNew(1, nil)
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, id.String()), os.ModePerm))
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, stagingDirPrefix+id.String(), "blockgen-head-1"), os.ModePerm))
+
+	testutil.Ok(t, RemovePartial(log.NewNopLogger(), dir))
+	entries, err := os.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(entries))
+	testutil.Equals(t, id.String(), entries[0].Name())
+
+	testutil.Ok(t, RemovePartial(log.NewNopLogger(), filepath.Join(dir, "missing")))
+}
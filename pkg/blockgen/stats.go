@@ -0,0 +1,219 @@
+package blockgen
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/thanos-io/objstore"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/indexheader"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+// LabelCardinality is the number of distinct values of a label.
+type LabelCardinality struct {
+	Name   string `json:"name"`
+	Values int    `json:"values"`
+}
+
+// SizeSummary summarises size of a block or a dataset.
+type SizeSummary struct {
+	Series     uint64 `json:"series"`
+	Samples    uint64 `json:"samples"`
+	Chunks     uint64 `json:"chunks"`
+	IndexBytes int64  `json:"indexBytes"`
+	ChunkBytes int64  `json:"chunkBytes"`
+	// BytesPerSample is the size of index and chunks per sample.
+	BytesPerSample float64 `json:"bytesPerSample"`
+	// TopLabels are labels with the most distinct values, in descending order.
+	TopLabels []LabelCardinality `json:"topLabels"`
+}
+
+// BlockReport summarises a block.
+type BlockReport struct {
+	ULID       ulid.ULID         `json:"ulid"`
+	MinTime    int64             `json:"minTime"`
+	MaxTime    int64             `json:"maxTime"`
+	Labels     map[string]string `json:"labels"`
+	Resolution int64             `json:"resolution"`
+	Level      int               `json:"level"`
+	SizeSummary
+}
+
+// DatasetReport summarises all blocks of a dataset. Series, samples, chunks and bytes of the total summary are
+// sums over blocks, label cardinalities count values distinct across all blocks.
+type DatasetReport struct {
+	Blocks  []BlockReport `json:"blocks"`
+	MinTime int64         `json:"minTime"`
+	MaxTime int64         `json:"maxTime"`
+	Total   SizeSummary   `json:"total"`
+}
+
+// Report summarises blocks in given bucket, with given number of labels of the highest cardinality. Labels are
+// read from index headers built in given directory, so only parts of indexes are fetched. Blocks without meta.json,
+// e.g. partially uploaded ones, are skipped.
+func Report(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, dir string, topLabels int) (DatasetReport, error) {
+	var ids []ulid.ULID
+	if err := bkt.Iter(ctx, "", func(name string) error {
+		if id, err := ulid.Parse(strings.TrimSuffix(name, "/")); err == nil {
+			ids = append(ids, id)
+		}
+		return nil
+	}); err != nil {
+		return DatasetReport{}, errors.Wrap(err, "iter bucket")
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i].Compare(ids[j]) < 0 })
+
+	r := DatasetReport{}
+	values := map[string]map[string]struct{}{}
+	for _, id := range ids {
+		meta, err := readMeta(ctx, bkt, id)
+		if bkt.IsObjNotFoundErr(errors.Cause(err)) {
+			level.Warn(logger).Log("msg", "block without meta.json, skipping", "block", id)
+			continue
+		}
+		if err != nil {
+			return r, err
+		}
+
+		b := BlockReport{
+			ULID:       id,
+			MinTime:    meta.MinTime,
+			MaxTime:    meta.MaxTime,
+			Labels:     meta.Thanos.Labels,
+			Resolution: meta.Thanos.Downsample.Resolution,
+			Level:      meta.Compaction.Level,
+			SizeSummary: SizeSummary{
+				Series:  meta.Stats.NumSeries,
+				Samples: meta.Stats.NumSamples,
+				Chunks:  meta.Stats.NumChunks,
+			},
+		}
+		if b.IndexBytes, b.ChunkBytes, err = blockSizes(ctx, bkt, id); err != nil {
+			return r, errors.Wrapf(err, "block %s sizes", id)
+		}
+		blockValues, err := labelValues(ctx, logger, bkt, dir, id)
+		if err != nil {
+			return r, errors.Wrapf(err, "block %s labels", id)
+		}
+		b.TopLabels = topCardinality(blockValues, topLabels)
+		b.BytesPerSample = bytesPerSample(b.SizeSummary)
+
+		for name, vs := range blockValues {
+			if values[name] == nil {
+				values[name] = map[string]struct{}{}
+			}
+			for _, v := range vs {
+				values[name][v] = struct{}{}
+			}
+		}
+		if len(r.Blocks) == 0 || b.MinTime < r.MinTime {
+			r.MinTime = b.MinTime
+		}
+		if len(r.Blocks) == 0 || b.MaxTime > r.MaxTime {
+			r.MaxTime = b.MaxTime
+		}
+		r.Total.Series += b.Series
+		r.Total.Samples += b.Samples
+		r.Total.Chunks += b.Chunks
+		r.Total.IndexBytes += b.IndexBytes
+		r.Total.ChunkBytes += b.ChunkBytes
+		r.Blocks = append(r.Blocks, b)
+	}
+
+	datasetValues := make(map[string][]string, len(values))
+	for name, vs := range values {
+		for v := range vs {
+			datasetValues[name] = append(datasetValues[name], v)
+		}
+	}
+	r.Total.TopLabels = topCardinality(datasetValues, topLabels)
+	r.Total.BytesPerSample = bytesPerSample(r.Total)
+	return r, nil
+}
+
+func readMeta(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID) (*metadata.Meta, error) {
+	rc, err := bkt.Get(ctx, path.Join(id.String(), metadata.MetaFilename))
+	if err != nil {
+		return nil, errors.Wrapf(err, "get meta of block %s", id)
+	}
+	meta, err := metadata.Read(rc)
+	return meta, errors.Wrapf(err, "read meta of block %s", id)
+}
+
+// blockSizes returns sizes of index and all chunk segment files of block.
+func blockSizes(ctx context.Context, bkt objstore.BucketReader, id ulid.ULID) (indexBytes, chunkBytes int64, _ error) {
+	attrs, err := bkt.Attributes(ctx, path.Join(id.String(), block.IndexFilename))
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "index attributes")
+	}
+	err = bkt.Iter(ctx, path.Join(id.String(), block.ChunksDirname), func(name string) error {
+		attrs, err := bkt.Attributes(ctx, name)
+		if err != nil {
+			return errors.Wrapf(err, "attributes of %s", name)
+		}
+		chunkBytes += attrs.Size
+		return nil
+	})
+	return attrs.Size, chunkBytes, err
+}
+
+// labelValues returns all values of all labels of block.
+func labelValues(ctx context.Context, logger log.Logger, bkt objstore.BucketReader, dir string, id ulid.ULID) (_ map[string][]string, err error) {
+	r, err := indexheader.NewBinaryReader(ctx, logger, bkt, dir, id, 32)
+	if err != nil {
+		return nil, errors.Wrap(err, "read index header")
+	}
+	defer runutil.CloseWithErrCapture(&err, r, "close index header")
+
+	names, err := r.LabelNames()
+	if err != nil {
+		return nil, errors.Wrap(err, "label names")
+	}
+	values := make(map[string][]string, len(names))
+	for _, name := range names {
+		vs, err := r.LabelValues(name)
+		if err != nil {
+			return nil, errors.Wrapf(err, "values of label %s", name)
+		}
+		// Strings are backed by mmaped index header, which is unmapped on close.
+		cloned := make([]string, 0, len(vs))
+		for _, v := range vs {
+			cloned = append(cloned, strings.Clone(v))
+		}
+		values[strings.Clone(name)] = cloned
+	}
+	return values, nil
+}
+
+// topCardinality returns up to n labels with the most values.
+func topCardinality(values map[string][]string, n int) []LabelCardinality {
+	top := make([]LabelCardinality, 0, len(values))
+	for name, vs := range values {
+		top = append(top, LabelCardinality{Name: name, Values: len(vs)})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Values != top[j].Values {
+			return top[i].Values > top[j].Values
+		}
+		return top[i].Name < top[j].Name
+	})
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+func bytesPerSample(s SizeSummary) float64 {
+	if s.Samples == 0 {
+		return 0
+	}
+	return float64(s.IndexBytes+s.ChunkBytes) / float64(s.Samples)
+}
@@ -0,0 +1,80 @@
+package blockgen
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/objstore/providers/filesystem"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+func TestReport(t *testing.T) {
+	dir := t.TempDir()
+	spec := func(mint, maxt int64, pods int) BlockSpec {
+		return BlockSpec{
+			Meta: metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{MinTime: mint, MaxTime: maxt},
+				Thanos:    metadata.Thanos{Labels: map[string]string{"cluster": "one"}},
+			},
+			Series: []SeriesSpec{{
+				Labels: labels.FromStrings("__name__", "kube_pod_info"),
+				Cardinality: seriesgen.CardinalityModel{
+					Labels: []seriesgen.LabelModel{
+						{Name: "namespace", Values: 2},
+						{Name: "pod", Values: pods, Parent: "namespace"},
+					},
+					Series: pods,
+				},
+				Type:            Gauge,
+				MinTime:         mint,
+				MaxTime:         maxt,
+				Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 1},
+			}},
+		}
+	}
+	var ids []ulid.ULID
+	for _, b := range []BlockSpec{
+		spec(0, durToMilis(2*time.Hour), 10),
+		spec(durToMilis(2*time.Hour), durToMilis(4*time.Hour), 20),
+	} {
+		id, err := Generate(context.Background(), log.NewNopLogger(), 2, dir, b)
+		testutil.Ok(t, err)
+		ids = append(ids, id)
+	}
+	// Partially written block is skipped.
+	testutil.Ok(t, os.MkdirAll(filepath.Join(dir, ulid.MustNew(1, nil).String(), "chunks"), os.ModePerm))
+
+	bkt, err := filesystem.NewBucket(dir)
+	testutil.Ok(t, err)
+	r, err := Report(context.Background(), log.NewNopLogger(), bkt, t.TempDir(), 2)
+	testutil.Ok(t, err)
+
+	testutil.Equals(t, 2, len(r.Blocks))
+	for i, b := range r.Blocks {
+		testutil.Equals(t, ids[i], b.ULID)
+		testutil.Equals(t, map[string]string{"cluster": "one"}, b.Labels)
+		testutil.Assert(t, b.IndexBytes > 0 && b.ChunkBytes > 0, "expected sizes of block %v", b.ULID)
+		testutil.Equals(t, float64(b.IndexBytes+b.ChunkBytes)/float64(b.Samples), b.BytesPerSample)
+	}
+	testutil.Equals(t, uint64(10), r.Blocks[0].Series)
+	testutil.Equals(t, []LabelCardinality{{Name: "pod", Values: 10}, {Name: "namespace", Values: 2}}, r.Blocks[0].TopLabels)
+
+	testutil.Equals(t, r.Blocks[0].MinTime, r.MinTime)
+	testutil.Equals(t, r.Blocks[1].MaxTime, r.MaxTime)
+	testutil.Equals(t, uint64(30), r.Total.Series)
+	testutil.Equals(t, r.Blocks[0].Samples+r.Blocks[1].Samples, r.Total.Samples)
+	testutil.Equals(t, r.Blocks[0].ChunkBytes+r.Blocks[1].ChunkBytes, r.Total.ChunkBytes)
+	// Values shared by both blocks are counted once.
+	testutil.Equals(t, 2, len(r.Total.TopLabels))
+	testutil.Equals(t, "pod", r.Total.TopLabels[0].Name)
+	testutil.Assert(t, r.Total.TopLabels[0].Values > 20 && r.Total.TopLabels[0].Values < 30, "unexpected pod cardinality %d", r.Total.TopLabels[0].Values)
+}
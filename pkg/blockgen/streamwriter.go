@@ -0,0 +1,478 @@
+package blockgen
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/oklog/ulid"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/timestamp"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/prometheus/prometheus/tsdb/tombstones"
+	thanosmeta "github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/errutil"
+	"github.com/thanos-io/thanos/pkg/runutil"
+)
+
+const (
+	// samplesPerChunk is the number of samples after which a new chunk is cut, same as in Prometheus head.
+	samplesPerChunk = 120
+	// chunkMetasSpillSize is the size of encoded chunk references of a single series kept in memory, before they
+	// are spilled to a temporary file.
+	chunkMetasSpillSize = 1024
+)
+
+var _ Writer = &StreamingBlockWriter{}
+
+// StreamingBlockWriter is implementation of Writer interface, which encodes chunks directly from appended samples and
+// writes them to the block right away. Memory does not grow with number of samples, only with number of series,
+// so blocks of any time range can be generated.
+//
+// It is assumed for single use. Samples of each series have to be appended in order and each series can be appended
+// only by one appender at the time. Appended samples are written immediately, so Rollback does not discard them
+// and the block should not be used if any append failed. Exemplars and metadata are ignored, as blocks do not
+// store them.
+type StreamingBlockWriter struct {
+	logger log.Logger
+	dir    string
+
+	id     ulid.ULID
+	tmpDir string
+
+	mtx    sync.RWMutex
+	hashes map[uint64][]*streamSeries
+	series []*streamSeries
+
+	chunksMtx    sync.Mutex
+	chunkw       *chunks.Writer
+	chunksClosed bool
+
+	// spill keeps encoded chunk references of all series, so they do not have to be kept in memory until Flush.
+	spillMtx sync.Mutex
+	spill    *os.File
+	spillOff int64
+
+	closed bool
+}
+
+// NewStreamingBlockWriter creates new streaming block writer.
+func NewStreamingBlockWriter(logger log.Logger, dir string) (*StreamingBlockWriter, error) {
+	w := &StreamingBlockWriter{
+		logger: logger,
+		dir:    dir,
+		id:     ulid.MustNew(ulid.Now(), rand.New(rand.NewSource(time.Now().UnixNano()))),
+		hashes: map[uint64][]*streamSeries{},
+	}
+	w.tmpDir = filepath.Join(dir, w.id.String()+".tmp-for-creation")
+	if err := os.MkdirAll(w.tmpDir, os.ModePerm); err != nil {
+		return nil, errors.Wrap(err, "create dir")
+	}
+
+	var err error
+	if w.chunkw, err = chunks.NewWriter(filepath.Join(w.tmpDir, "chunks")); err != nil {
+		_ = os.RemoveAll(w.tmpDir)
+		return nil, errors.Wrap(err, "create chunk writer")
+	}
+	if w.spill, err = os.CreateTemp(dir, "blockgen-chunk-metas-"); err != nil {
+		_ = w.chunkw.Close()
+		_ = os.RemoveAll(w.tmpDir)
+		return nil, errors.Wrap(err, "create chunk metas file")
+	}
+	return w, nil
+}
+
+// Appender implements storage.Appendable. Returned appender is thread-safe.
+func (w *StreamingBlockWriter) Appender(_ context.Context) storage.Appender {
+	return &streamAppender{w: w}
+}
+
+// Flush implements Writer interface. It writes the index of all appended series and moves the block to its
+// final directory. After flush completes, no write can be done.
+func (w *StreamingBlockWriter) Flush() (_ ulid.ULID, err error) {
+	defer runutil.CloseWithErrCapture(&err, w, "close writer")
+
+	if len(w.series) == 0 {
+		return ulid.ULID{}, errors.New("no series appended; aborting.")
+	}
+
+	meta := &thanosmeta.Meta{
+		BlockMeta: tsdb.BlockMeta{
+			ULID:       w.id,
+			MinTime:    math.MaxInt64,
+			MaxTime:    math.MinInt64,
+			Version:    thanosmeta.TSDBVersion1,
+			Compaction: tsdb.BlockMetaCompaction{Level: 1, Sources: []ulid.ULID{w.id}},
+		},
+		Thanos: thanosmeta.Thanos{Version: thanosmeta.ThanosVersion1, Source: "blockgen"},
+	}
+	symbols := map[string]struct{}{}
+	for _, s := range w.series {
+		if err := w.cutChunk(s); err != nil {
+			return ulid.ULID{}, err
+		}
+		if s.numChunks == 0 {
+			continue
+		}
+		if s.mint < meta.MinTime {
+			meta.MinTime = s.mint
+		}
+		if s.maxt > meta.MaxTime {
+			meta.MaxTime = s.maxt
+		}
+		meta.Stats.NumSeries++
+		meta.Stats.NumChunks += uint64(s.numChunks)
+		meta.Stats.NumSamples += s.numSamples
+		for _, l := range s.lset {
+			symbols[l.Name] = struct{}{}
+			symbols[l.Value] = struct{}{}
+		}
+	}
+	// Block range is half-open.
+	meta.MaxTime++
+	w.chunksClosed = true
+	if err := w.chunkw.Close(); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "close chunk writer")
+	}
+
+	level.Info(w.logger).Log(
+		"msg", "flushing",
+		"series_count", meta.Stats.NumSeries,
+		"mint", timestamp.Time(meta.MinTime),
+		"maxt", timestamp.Time(meta.MaxTime),
+	)
+	if err := w.writeIndex(symbols); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write index")
+	}
+	if _, err := tombstones.WriteFile(w.logger, w.tmpDir, tombstones.NewMemTombstones()); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write tombstones")
+	}
+	if err := meta.WriteToDir(w.logger, w.tmpDir); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write meta")
+	}
+	if err := os.Rename(w.tmpDir, filepath.Join(w.dir, w.id.String())); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "rename block dir")
+	}
+	return w.id, nil
+}
+
+// Close implements Writer interface. It removes the temporary file with chunk references and, if block was not
+// flushed, the block directory.
+func (w *StreamingBlockWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var merr errutil.MultiError
+	if !w.chunksClosed {
+		w.chunksClosed = true
+		merr.Add(errors.Wrap(w.chunkw.Close(), "close chunk writer"))
+	}
+	merr.Add(errors.Wrap(w.spill.Close(), "close chunk metas file"))
+	merr.Add(errors.Wrap(os.Remove(w.spill.Name()), "remove chunk metas file"))
+	// Directory of flushed block was already renamed.
+	merr.Add(errors.Wrap(os.RemoveAll(w.tmpDir), "remove block dir"))
+	return merr.Err()
+}
+
+func (w *StreamingBlockWriter) writeIndex(symbols map[string]struct{}) error {
+	syms := make([]string, 0, len(symbols))
+	for s := range symbols {
+		syms = append(syms, s)
+	}
+	sort.Strings(syms)
+
+	series := make([]*streamSeries, 0, len(w.series))
+	for _, s := range w.series {
+		if s.numChunks > 0 {
+			series = append(series, s)
+		}
+	}
+	sort.Slice(series, func(i, j int) bool { return labels.Compare(series[i].lset, series[j].lset) < 0 })
+
+	iw, err := index.NewWriter(context.Background(), filepath.Join(w.tmpDir, "index"))
+	if err != nil {
+		return errors.Wrap(err, "create index writer")
+	}
+	for _, s := range syms {
+		if err := iw.AddSymbol(s); err != nil {
+			_ = iw.Close()
+			return errors.Wrap(err, "add symbol")
+		}
+	}
+	var chks []chunks.Meta
+	for i, s := range series {
+		if chks, err = w.chunkMetas(s, chks[:0]); err != nil {
+			_ = iw.Close()
+			return err
+		}
+		if err := iw.AddSeries(storage.SeriesRef(i), s.lset, chks...); err != nil {
+			_ = iw.Close()
+			return errors.Wrapf(err, "add series %s", s.lset)
+		}
+	}
+	return iw.Close()
+}
+
+// chunkMetas decodes spilled and in-memory chunk references of given series.
+func (w *StreamingBlockWriter) chunkMetas(s *streamSeries, chks []chunks.Meta) ([]chunks.Meta, error) {
+	var ref, maxt int64
+	decode := func(b []byte) error {
+		for len(b) > 0 {
+			var vs [3]int64
+			for i := range vs {
+				v, n := binary.Varint(b)
+				if n <= 0 {
+					return errors.Errorf("corrupted chunk metas of series %s", s.lset)
+				}
+				vs[i], b = v, b[n:]
+			}
+			ref += vs[0]
+			mint := maxt + vs[1]
+			maxt = mint + vs[2]
+			chks = append(chks, chunks.Meta{Ref: chunks.ChunkRef(ref), MinTime: mint, MaxTime: maxt})
+		}
+		return nil
+	}
+
+	for _, sp := range s.spilled {
+		b := make([]byte, sp.length)
+		if _, err := w.spill.ReadAt(b, sp.offset); err != nil {
+			return nil, errors.Wrap(err, "read chunk metas")
+		}
+		if err := decode(b); err != nil {
+			return nil, err
+		}
+	}
+	return chks, decode(s.metas)
+}
+
+// cutChunk writes the current chunk of the series, if any.
+func (w *StreamingBlockWriter) cutChunk(s *streamSeries) error {
+	if s.chunk == nil || s.chunk.NumSamples() == 0 {
+		return nil
+	}
+	chk := []chunks.Meta{{MinTime: s.chunkMint, MaxTime: s.lastT, Chunk: s.chunk}}
+
+	w.chunksMtx.Lock()
+	err := w.chunkw.WriteChunks(chk...)
+	w.chunksMtx.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "write chunk")
+	}
+	// Appender of the written chunk is kept, so the next histogram sample can be checked for counter reset.
+	s.chunk = nil
+
+	var buf [binary.MaxVarintLen64]byte
+	for _, v := range []int64{int64(chk[0].Ref) - s.lastRef, chk[0].MinTime - s.lastMaxt, chk[0].MaxTime - chk[0].MinTime} {
+		n := binary.PutVarint(buf[:], v)
+		s.metas = append(s.metas, buf[:n]...)
+	}
+	s.lastRef, s.lastMaxt = int64(chk[0].Ref), chk[0].MaxTime
+	s.numChunks++
+	if len(s.metas) < chunkMetasSpillSize {
+		return nil
+	}
+
+	w.spillMtx.Lock()
+	defer w.spillMtx.Unlock()
+	if _, err := w.spill.WriteAt(s.metas, w.spillOff); err != nil {
+		return errors.Wrap(err, "spill chunk metas")
+	}
+	s.spilled = append(s.spilled, spillSegment{offset: w.spillOff, length: len(s.metas)})
+	w.spillOff += int64(len(s.metas))
+	s.metas = s.metas[:0]
+	return nil
+}
+
+// getOrCreate returns series for given reference or, if the reference is unknown, labels.
+func (w *StreamingBlockWriter) getOrCreate(ref storage.SeriesRef, lset labels.Labels) (storage.SeriesRef, *streamSeries) {
+	w.mtx.RLock()
+	if ref > 0 && int(ref) <= len(w.series) {
+		s := w.series[ref-1]
+		w.mtx.RUnlock()
+		return ref, s
+	}
+	w.mtx.RUnlock()
+
+	hash := lset.Hash()
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	for _, s := range w.hashes[hash] {
+		if labels.Equal(s.lset, lset) {
+			return s.ref, s
+		}
+	}
+	s := &streamSeries{lset: lset.Copy(), ref: storage.SeriesRef(len(w.series) + 1), lastT: math.MinInt64, mint: math.MaxInt64}
+	w.series = append(w.series, s)
+	w.hashes[hash] = append(w.hashes[hash], s)
+	return s.ref, s
+}
+
+type spillSegment struct {
+	offset int64
+	length int
+}
+
+type streamSeries struct {
+	mtx  sync.Mutex
+	lset labels.Labels
+	ref  storage.SeriesRef
+
+	chunk     chunkenc.Chunk
+	app       chunkenc.Appender
+	chunkMint int64
+	lastT     int64
+	// lastValue and lastHistogram are the last appended sample, to tell duplicates from conflicting samples.
+	lastValue     float64
+	lastHistogram *histogram.Histogram
+
+	mint, maxt int64
+	numSamples uint64
+	numChunks  int
+
+	// metas are varint encoded deltas of chunk references, min and max times, not spilled yet.
+	metas             []byte
+	lastRef, lastMaxt int64
+	spilled           []spillSegment
+}
+
+type streamAppender struct {
+	w *StreamingBlockWriter
+}
+
+// append appends sample of given series with appendFn. Sample with the same timestamp as the last one is ignored,
+// if isLast returns true for it.
+func (a *streamAppender) append(ref storage.SeriesRef, lset labels.Labels, t int64, enc chunkenc.Encoding, isLast func(s *streamSeries) bool, appendFn func(s *streamSeries) error) (storage.SeriesRef, error) {
+	ref, s := a.w.getOrCreate(ref, lset)
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if t < s.lastT {
+		return 0, storage.ErrOutOfOrderSample
+	}
+	if t == s.lastT {
+		// Same as head, ignore exact duplicates only.
+		if !isLast(s) {
+			return 0, storage.ErrDuplicateSampleForTimestamp
+		}
+		return ref, nil
+	}
+	if s.chunk != nil && (s.chunk.Encoding() != enc || s.chunk.NumSamples() >= samplesPerChunk) {
+		if err := a.w.cutChunk(s); err != nil {
+			return 0, err
+		}
+	}
+	if err := appendFn(s); err != nil {
+		return 0, err
+	}
+
+	if t < s.mint {
+		s.mint = t
+	}
+	s.maxt = t
+	s.lastT = t
+	s.numSamples++
+	return ref, nil
+}
+
+// newChunk starts a new chunk of given encoding.
+func (s *streamSeries) newChunk(enc chunkenc.Encoding, t int64) error {
+	var err error
+	switch enc {
+	case chunkenc.EncHistogram:
+		s.chunk = chunkenc.NewHistogramChunk()
+	default:
+		s.chunk = chunkenc.NewXORChunk()
+	}
+	s.app, err = s.chunk.Appender()
+	s.chunkMint = t
+	return err
+}
+
+func (a *streamAppender) Append(ref storage.SeriesRef, lset labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	isLast := func(s *streamSeries) bool {
+		return s.lastHistogram == nil && math.Float64bits(s.lastValue) == math.Float64bits(v)
+	}
+	return a.append(ref, lset, t, chunkenc.EncXOR, isLast, func(s *streamSeries) error {
+		if s.chunk == nil {
+			if err := s.newChunk(chunkenc.EncXOR, t); err != nil {
+				return err
+			}
+		}
+		s.app.Append(t, v)
+		s.lastValue, s.lastHistogram = v, nil
+		return nil
+	})
+}
+
+func (a *streamAppender) AppendHistogram(ref storage.SeriesRef, lset labels.Labels, t int64, h *histogram.Histogram) (storage.SeriesRef, error) {
+	isLast := func(s *streamSeries) bool { return s.lastHistogram != nil && h.Equals(s.lastHistogram) }
+	return a.append(ref, lset, t, chunkenc.EncHistogram, isLast, func(s *streamSeries) error {
+		// Same as head, recode the chunk if new buckets appear and cut a new one on counter reset.
+		header := chunkenc.UnknownCounterReset
+		if app, ok := s.app.(*chunkenc.HistogramAppender); ok {
+			posInterjections, negInterjections, okToAppend, counterReset := app.Appendable(h)
+			switch {
+			case counterReset:
+				header = chunkenc.CounterReset
+			case okToAppend:
+				header = chunkenc.NotCounterReset
+			}
+
+			if s.chunk != nil {
+				switch {
+				case !okToAppend || counterReset:
+					if err := a.w.cutChunk(s); err != nil {
+						return err
+					}
+				case len(posInterjections) > 0 || len(negInterjections) > 0:
+					s.chunk, s.app = app.Recode(posInterjections, negInterjections, h.PositiveSpans, h.NegativeSpans)
+				}
+			}
+		}
+		if s.chunk == nil {
+			if err := s.newChunk(chunkenc.EncHistogram, t); err != nil {
+				return err
+			}
+			s.chunk.(*chunkenc.HistogramChunk).SetCounterResetHeader(header)
+		}
+		s.app.AppendHistogram(t, h)
+		s.lastHistogram = h
+		return nil
+	})
+}
+
+// AppendExemplar implements storage.Appender. Blocks do not store exemplars, so they are ignored.
+func (a *streamAppender) AppendExemplar(ref storage.SeriesRef, _ labels.Labels, _ exemplar.Exemplar) (storage.SeriesRef, error) {
+	return ref, nil
+}
+
+// UpdateMetadata implements storage.Appender. Blocks do not store metadata, so it is ignored.
+func (a *streamAppender) UpdateMetadata(ref storage.SeriesRef, _ labels.Labels, _ metadata.Metadata) (storage.SeriesRef, error) {
+	return ref, nil
+}
+
+// Commit implements storage.Appender. Samples are written on append, so it does nothing.
+func (a *streamAppender) Commit() error { return nil }
+
+// Rollback implements storage.Appender. Appended samples are already written, so they are not discarded.
+func (a *streamAppender) Rollback() error { return nil }
@@ -0,0 +1,225 @@
+package blockgen
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+func TestGenerateStreaming(t *testing.T) {
+	// Five days of 15s samples make enough chunks per series for chunk references to be spilled.
+	maxt := durToMilis(5 * 24 * time.Hour)
+	spec := BlockSpec{
+		Meta: metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"cluster": "one"}},
+		},
+		Series: []SeriesSpec{
+			{
+				Labels:  labels.FromStrings("__name__", "up"),
+				Targets: 3,
+				Type:    Gauge,
+				MinTime: 0,
+				MaxTime: maxt,
+				Characteristics: seriesgen.Characteristics{
+					ScrapeInterval: 15 * time.Second,
+					Max:            100,
+					Gaps:           seriesgen.GapCharacteristics{MissedScrapeProbability: 0.1},
+				},
+			},
+			{
+				Labels:  labels.FromStrings("__name__", "http_requests_total"),
+				Targets: 2,
+				Type:    Counter,
+				MinTime: 0,
+				MaxTime: maxt,
+				Characteristics: seriesgen.Characteristics{
+					ScrapeInterval: 15 * time.Second,
+					Max:            100,
+				},
+			},
+			{
+				Labels:  labels.FromStrings("__name__", "http_request_duration_seconds"),
+				Targets: 2,
+				Type:    NativeHistogram,
+				MinTime: 0,
+				MaxTime: durToMilis(2 * time.Hour),
+				Characteristics: seriesgen.Characteristics{
+					ScrapeInterval: 15 * time.Second,
+					Min:            0.001,
+					Histogram:      seriesgen.HistogramCharacteristics{Schema: 2, Buckets: 15, ObservationRate: 10},
+				},
+			},
+		},
+	}
+
+	readBlock := func(t *testing.T, dir string, id fmt.Stringer) (tsdb.BlockMeta, map[string][]string) {
+		t.Helper()
+
+		b, err := tsdb.OpenBlock(log.NewNopLogger(), filepath.Join(dir, id.String()), nil)
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, b.Close()) }()
+		q, err := tsdb.NewBlockQuerier(b, b.MinTime(), b.MaxTime())
+		testutil.Ok(t, err)
+		defer func() { testutil.Ok(t, q.Close()) }()
+		return b.Meta(), selectAll(t, q.Select(true, nil, labels.MustNewMatcher(labels.MatchRegexp, "__name__", ".+")))
+	}
+
+	dir := t.TempDir()
+	id, err := Generate(context.Background(), log.NewNopLogger(), 4, dir, spec)
+	testutil.Ok(t, err)
+	expectedMeta, expected := readBlock(t, dir, id)
+
+	dir = t.TempDir()
+	id, err = GenerateStreaming(context.Background(), log.NewNopLogger(), 4, dir, spec)
+	testutil.Ok(t, err)
+	gotMeta, got := readBlock(t, dir, id)
+
+	// Streaming writer produces the same data, only chunked differently.
+	testutil.Equals(t, 7, len(got))
+	testutil.Equals(t, expected, got)
+	testutil.Equals(t, expectedMeta.MinTime, gotMeta.MinTime)
+	testutil.Equals(t, expectedMeta.MaxTime, gotMeta.MaxTime)
+	testutil.Equals(t, expectedMeta.Stats.NumSeries, gotMeta.Stats.NumSeries)
+	testutil.Equals(t, expectedMeta.Stats.NumSamples, gotMeta.Stats.NumSamples)
+
+	meta, err := metadata.ReadFromDir(filepath.Join(dir, id.String()))
+	testutil.Ok(t, err)
+	testutil.Equals(t, map[string]string{"cluster": "one"}, meta.Thanos.Labels)
+
+	// Only the block is left in the directory.
+	entries, err := os.ReadDir(dir)
+	testutil.Ok(t, err)
+	testutil.Equals(t, 1, len(entries))
+}
+
+func TestGenerateWithWriter_Error(t *testing.T) {
+	maxt := durToMilis(2 * time.Hour)
+	spec := BlockSpec{
+		Meta: metadata.Meta{BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt}},
+		Series: []SeriesSpec{{
+			Labels:          labels.FromStrings("__name__", "up"),
+			Targets:         3,
+			Type:            Gauge,
+			MinTime:         0,
+			MaxTime:         maxt,
+			Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 100},
+		}},
+	}
+	for _, tcase := range []struct {
+		name      string
+		newWriter func(dir string) (Writer, error)
+	}{
+		{
+			name: "head",
+			newWriter: func(dir string) (Writer, error) {
+				return NewTSDBBlockWriter(log.NewNopLogger(), dir, BlockWriterOptions{})
+			},
+		},
+		{
+			name: "streaming",
+			newWriter: func(dir string) (Writer, error) {
+				return NewStreamingBlockWriter(log.NewNopLogger(), dir)
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			dir := t.TempDir()
+			w, err := tcase.newWriter(dir)
+			testutil.Ok(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = GenerateWithWriter(ctx, log.NewNopLogger(), 2, w, dir, spec)
+			testutil.NotOk(t, err)
+
+			// Temporary files of the writer are removed.
+			entries, err := os.ReadDir(dir)
+			testutil.Ok(t, err)
+			testutil.Equals(t, 0, len(entries))
+		})
+	}
+}
+
+func TestWriters_DuplicateSamples(t *testing.T) {
+	h := func(count uint64) *histogram.Histogram {
+		return &histogram.Histogram{
+			Count:           count,
+			ZeroCount:       count,
+			ZeroThreshold:   0.001,
+			PositiveSpans:   []histogram.Span{},
+			NegativeSpans:   []histogram.Span{},
+			PositiveBuckets: []int64{},
+			NegativeBuckets: []int64{},
+		}
+	}
+	for _, tcase := range []struct {
+		name      string
+		newWriter func(dir string) (Writer, error)
+	}{
+		{
+			name: "head",
+			newWriter: func(dir string) (Writer, error) {
+				return NewTSDBBlockWriter(log.NewNopLogger(), dir, BlockWriterOptions{})
+			},
+		},
+		{
+			name: "streaming",
+			newWriter: func(dir string) (Writer, error) {
+				return NewStreamingBlockWriter(log.NewNopLogger(), dir)
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			w, err := tcase.newWriter(t.TempDir())
+			testutil.Ok(t, err)
+			defer func() { testutil.Ok(t, w.Close()) }()
+
+			floats, histograms := labels.FromStrings("__name__", "up"), labels.FromStrings("__name__", "latency")
+			for _, c := range []struct {
+				lset labels.Labels
+				t    int64
+				v    float64
+				h    *histogram.Histogram
+				err  error
+			}{
+				{lset: floats, t: 1000, v: 1},
+				// Exact duplicate is ignored.
+				{lset: floats, t: 1000, v: 1},
+				{lset: floats, t: 1000, v: 2, err: storage.ErrDuplicateSampleForTimestamp},
+				{lset: floats, t: 2000, v: 2},
+				{lset: histograms, t: 1000, h: h(1)},
+				{lset: histograms, t: 1000, h: h(1)},
+				{lset: histograms, t: 1000, h: h(2), err: storage.ErrDuplicateSampleForTimestamp},
+				{lset: histograms, t: 2000, h: h(2)},
+			} {
+				// Head checks samples against committed ones only.
+				app := w.Appender(context.Background())
+				if c.h != nil {
+					_, err = app.AppendHistogram(0, c.lset, c.t, c.h)
+				} else {
+					_, err = app.Append(0, c.lset, c.t, c.v)
+				}
+				testutil.Equals(t, c.err, errors.Cause(err))
+				if err != nil {
+					testutil.Ok(t, app.Rollback())
+					continue
+				}
+				testutil.Ok(t, app.Commit())
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package blockgen
+
+import (
+	"math"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/chunks"
+	"github.com/prometheus/prometheus/tsdb/index"
+	"github.com/thanos-io/thanos/pkg/block"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanos/pkg/errutil"
+	"github.com/thanos-io/thanos/pkg/runutil"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+// BlockStats are statistics of a block gathered by reading all its series and chunks.
+type BlockStats struct {
+	Series  int64
+	Chunks  int64
+	Samples int64
+	// MinTime and MaxTime are timestamps of the oldest and the newest sample.
+	MinTime, MaxTime int64
+}
+
+// ReadBlockStats reads all series and chunks of block in given directory. Chunks have to be readable and have
+// samples within their time range. Samples of downsampled blocks are aggregated samples.
+func ReadBlockStats(logger log.Logger, bdir string) (_ BlockStats, err error) {
+	stats := BlockStats{MinTime: math.MaxInt64, MaxTime: math.MinInt64}
+
+	b, err := tsdb.OpenBlock(logger, bdir, downsample.NewPool())
+	if err != nil {
+		return stats, errors.Wrap(err, "open block")
+	}
+	defer runutil.CloseWithErrCapture(&err, b, "close block")
+	ir, err := b.Index()
+	if err != nil {
+		return stats, errors.Wrap(err, "open index")
+	}
+	defer runutil.CloseWithErrCapture(&err, ir, "close index")
+	cr, err := b.Chunks()
+	if err != nil {
+		return stats, errors.Wrap(err, "open chunks")
+	}
+	defer runutil.CloseWithErrCapture(&err, cr, "close chunks")
+
+	p, err := ir.Postings(index.AllPostingsKey())
+	if err != nil {
+		return stats, errors.Wrap(err, "get all postings")
+	}
+	var (
+		lset labels.Labels
+		chks []chunks.Meta
+		it   chunkenc.Iterator
+	)
+	for p.Next() {
+		if err := ir.Series(p.At(), &lset, &chks); err != nil {
+			return stats, errors.Wrap(err, "read series")
+		}
+		stats.Series++
+
+		for _, cm := range chks {
+			chk, err := cr.Chunk(cm)
+			if err != nil {
+				return stats, errors.Wrapf(err, "read chunk %d of series %s", cm.Ref, lset)
+			}
+			if ac, ok := chk.(*downsample.AggrChunk); ok {
+				// Count aggregate has timestamps of all aggregated samples.
+				if chk, err = ac.Get(downsample.AggrCount); err != nil {
+					return stats, errors.Wrapf(err, "read count aggregate of chunk %d of series %s", cm.Ref, lset)
+				}
+			}
+
+			n := 0
+			it = chk.Iterator(it)
+			for it.Next() != chunkenc.ValNone {
+				t := it.AtT()
+				if t < cm.MinTime || t > cm.MaxTime {
+					return stats, errors.Errorf("sample %d outside of chunk %d time range [%d, %d] of series %s", t, cm.Ref, cm.MinTime, cm.MaxTime, lset)
+				}
+				if t < stats.MinTime {
+					stats.MinTime = t
+				}
+				if t > stats.MaxTime {
+					stats.MaxTime = t
+				}
+				n++
+			}
+			if err := it.Err(); err != nil {
+				return stats, errors.Wrapf(err, "iterate chunk %d of series %s", cm.Ref, lset)
+			}
+			if n != chk.NumSamples() {
+				return stats, errors.Errorf("chunk %d of series %s has %d samples, expected %d", cm.Ref, lset, n, chk.NumSamples())
+			}
+			stats.Chunks++
+			stats.Samples += int64(n)
+		}
+	}
+	return stats, errors.Wrap(p.Err(), "iterate postings")
+}
+
+// Verify checks block in given directory. Index has to pass Thanos index health checks, so series and labels
+// are sorted and chunks are within block time range. All chunks have to be readable and block meta has to match
+// the data. If spec is not nil, series, samples and time range are compared with the spec as well. The number of
+// samples can differ from the spec by given relative tolerance.
+func Verify(logger log.Logger, bdir string, spec *BlockSpec, tolerance float64) error {
+	meta, err := metadata.ReadFromDir(bdir)
+	if err != nil {
+		return errors.Wrap(err, "read meta")
+	}
+	health, err := block.GatherIndexHealthStats(logger, filepath.Join(bdir, block.IndexFilename), meta.MinTime, meta.MaxTime)
+	if err != nil {
+		return errors.Wrap(err, "gather index health stats")
+	}
+	stats, err := ReadBlockStats(logger, bdir)
+	if err != nil {
+		return err
+	}
+
+	var merr errutil.MultiError
+	if err := health.AnyErr(); err != nil {
+		merr.Add(errors.Wrap(err, "index"))
+	}
+	for _, c := range []struct {
+		name     string
+		meta     uint64
+		expected int64
+	}{
+		{name: "series", meta: meta.Stats.NumSeries, expected: stats.Series},
+		{name: "chunks", meta: meta.Stats.NumChunks, expected: stats.Chunks},
+		{name: "samples", meta: meta.Stats.NumSamples, expected: stats.Samples},
+	} {
+		if int64(c.meta) != c.expected {
+			merr.Add(errors.Errorf("meta has %d %s, block has %d", c.meta, c.name, c.expected))
+		}
+	}
+	if stats.Samples > 0 && (stats.MinTime < meta.MinTime || stats.MaxTime >= meta.MaxTime) {
+		merr.Add(errors.Errorf("samples within [%d, %d] outside of meta time range [%d, %d)", stats.MinTime, stats.MaxTime, meta.MinTime, meta.MaxTime))
+	}
+
+	if spec != nil {
+		merr.Add(verifySpec(meta, stats, *spec, tolerance))
+	}
+	return merr.Err()
+}
+
+func verifySpec(meta *metadata.Meta, stats BlockStats, spec BlockSpec, tolerance float64) error {
+	var merr errutil.MultiError
+	if !matchesSpec(meta, spec) {
+		merr.Add(errors.Errorf("external labels %v, resolution %d or compaction level %d do not match spec", meta.Thanos.Labels, meta.Thanos.Downsample.Resolution, meta.Compaction.Level))
+	}
+	if expected := int64(spec.NumSeries()); stats.Series != expected {
+		merr.Add(errors.Errorf("block has %d series, spec %d", stats.Series, expected))
+	}
+
+	var (
+		interval time.Duration
+		gaps     = spec.Replica.Gaps != (seriesgen.GapCharacteristics{})
+	)
+	for _, s := range spec.Series {
+		if s.ScrapeInterval > interval {
+			interval = s.ScrapeInterval
+		}
+		if s.Gaps != (seriesgen.GapCharacteristics{}) {
+			gaps = true
+		}
+	}
+	// Samples of downsampled blocks are aggregates, so only raw samples are checked.
+	if meta.Thanos.Downsample.Resolution == 0 {
+		expected := spec.NumSamples()
+		diff := float64(stats.Samples - expected)
+		if gaps {
+			// Missed scrapes and outages only remove samples.
+			diff = math.Max(diff, 0)
+		}
+		if math.Abs(diff) > tolerance*float64(expected) {
+			merr.Add(errors.Errorf("block has %d samples, spec %d", stats.Samples, expected))
+		}
+	}
+
+	// Series generators start one scrape interval after series MinTime and end up to one interval after MaxTime.
+	// Timestamp irregularities move samples by less than another interval.
+	slack := 2 * interval.Milliseconds()
+	if stats.Samples > 0 && (stats.MinTime < spec.MinTime-slack || stats.MaxTime > spec.MaxTime+slack) {
+		merr.Add(errors.Errorf("samples within [%d, %d] outside of spec time range [%d, %d]", stats.MinTime, stats.MaxTime, spec.MinTime, spec.MaxTime))
+	}
+	return merr.Err()
+}
+
+// matchesSpec returns true if block can be generated from given spec, ignoring its time range.
+func matchesSpec(meta *metadata.Meta, spec BlockSpec) bool {
+	lset, specLset := meta.Thanos.Labels, spec.Thanos.Labels
+	if len(lset) == 0 && len(specLset) == 0 {
+		lset, specLset = nil, nil
+	}
+	if !reflect.DeepEqual(lset, specLset) || meta.Thanos.Downsample.Resolution != spec.Thanos.Downsample.Resolution {
+		return false
+	}
+	return spec.Compaction.Level == 0 || spec.Compaction.Level == meta.Compaction.Level
+}
+
+// MatchSpecs returns index of spec each of given blocks was generated from or -1 if there is none. Block with hash
+// of spec in meta matches that spec. Otherwise block matches spec with the same external labels, resolution and
+// compaction level. If there are more such blocks, the one with time range most similar to the spec is chosen.
+// Each spec matches at most one block.
+func MatchSpecs(metas []*metadata.Meta, specs []BlockSpec) []int {
+	matched := make([]int, len(metas))
+	byHash := map[string]int{}
+	for i, meta := range metas {
+		matched[i] = -1
+		if hash, ok := SpecHash(meta); ok {
+			byHash[hash] = i
+		}
+	}
+	specMatched := make([]bool, len(specs))
+	for i, spec := range specs {
+		hash, err := spec.Hash()
+		if err != nil {
+			continue
+		}
+		if j, ok := byHash[hash]; ok && matched[j] < 0 {
+			matched[j] = i
+			specMatched[i] = true
+		}
+	}
+
+	for i, spec := range specs {
+		if specMatched[i] {
+			continue
+		}
+		best, bestScore := -1, 0.0
+		for j, meta := range metas {
+			if matched[j] >= 0 || !matchesSpec(meta, spec) {
+				continue
+			}
+			// Ratio of intersection and union of time ranges.
+			intersection := math.Min(float64(meta.MaxTime), float64(spec.MaxTime)) - math.Max(float64(meta.MinTime), float64(spec.MinTime))
+			union := math.Max(float64(meta.MaxTime), float64(spec.MaxTime)) - math.Min(float64(meta.MinTime), float64(spec.MinTime))
+			if intersection <= 0 || union <= 0 {
+				continue
+			}
+			if score := intersection / union; score > bestScore {
+				best, bestScore = j, score
+			}
+		}
+		if best >= 0 {
+			matched[best] = i
+		}
+	}
+	return matched
+}
@@ -0,0 +1,143 @@
+package blockgen
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/oklog/ulid"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/tsdb"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
+	"github.com/thanos-io/thanos/pkg/compact/downsample"
+	"github.com/thanos-io/thanosbench/pkg/seriesgen"
+)
+
+func TestVerify(t *testing.T) {
+	maxt := durToMilis(48 * time.Hour)
+	spec := func(resolution int64) BlockSpec {
+		return BlockSpec{
+			Meta: metadata.Meta{
+				BlockMeta: tsdb.BlockMeta{MinTime: 0, MaxTime: maxt},
+				Thanos: metadata.Thanos{
+					Labels:     map[string]string{"cluster": "one"},
+					Downsample: metadata.ThanosDownsample{Resolution: resolution},
+				},
+			},
+			Series: []SeriesSpec{
+				{
+					Labels:          labels.FromStrings("__name__", "up"),
+					Targets:         2,
+					Type:            Gauge,
+					MinTime:         0,
+					MaxTime:         maxt,
+					Characteristics: seriesgen.Characteristics{ScrapeInterval: 15 * time.Second, Max: 100},
+				},
+				{
+					Labels:  labels.FromStrings("__name__", "http_requests_total"),
+					Targets: 2,
+					Type:    Counter,
+					MinTime: 0,
+					MaxTime: maxt,
+					Characteristics: seriesgen.Characteristics{
+						ScrapeInterval: 15 * time.Second,
+						Max:            100,
+						Gaps:           seriesgen.GapCharacteristics{MissedScrapeProbability: 0.01},
+					},
+				},
+			},
+		}
+	}
+	generate := func(t *testing.T, b BlockSpec) string {
+		dir := t.TempDir()
+		id, err := Generate(context.Background(), log.NewNopLogger(), 2, dir, b)
+		testutil.Ok(t, err)
+		return filepath.Join(dir, id.String())
+	}
+
+	t.Run("raw", func(t *testing.T) {
+		b := spec(0)
+		bdir := generate(t, b)
+		testutil.Ok(t, Verify(log.NewNopLogger(), bdir, nil, 0))
+		testutil.Ok(t, Verify(log.NewNopLogger(), bdir, &b, 0.01))
+
+		stats, err := ReadBlockStats(log.NewNopLogger(), bdir)
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(4), stats.Series)
+		testutil.Assert(t, stats.Samples < b.NumSamples(), "expected missed scrapes")
+
+		// Without gaps in spec, samples have to be within tolerance in both directions.
+		noGaps := b
+		noGaps.Series = append([]SeriesSpec{}, b.Series...)
+		noGaps.Series[1].Gaps = seriesgen.GapCharacteristics{}
+		testutil.Ok(t, Verify(log.NewNopLogger(), bdir, &noGaps, 0.01))
+		testutil.NotOk(t, Verify(log.NewNopLogger(), bdir, &noGaps, 0))
+
+		moreSeries := b
+		moreSeries.Series = append([]SeriesSpec{}, b.Series...)
+		moreSeries.Series[0].Targets = 3
+		testutil.NotOk(t, Verify(log.NewNopLogger(), bdir, &moreSeries, 0.01))
+
+		shifted := b
+		shifted.MinTime, shifted.MaxTime = durToMilis(time.Hour), maxt+durToMilis(time.Hour)
+		testutil.NotOk(t, Verify(log.NewNopLogger(), bdir, &shifted, 0.01))
+
+		otherLabels := b
+		otherLabels.Thanos.Labels = map[string]string{"cluster": "two"}
+		testutil.NotOk(t, Verify(log.NewNopLogger(), bdir, &otherLabels, 0.01))
+
+		// Meta stats have to match the data.
+		meta, err := metadata.ReadFromDir(bdir)
+		testutil.Ok(t, err)
+		meta.Stats.NumSamples++
+		testutil.Ok(t, meta.WriteToDir(log.NewNopLogger(), bdir))
+		testutil.NotOk(t, Verify(log.NewNopLogger(), bdir, nil, 0))
+	})
+	t.Run("downsampled", func(t *testing.T) {
+		b := spec(downsample.ResLevel1)
+		bdir := generate(t, b)
+		testutil.Ok(t, Verify(log.NewNopLogger(), bdir, &b, 0.01))
+
+		stats, err := ReadBlockStats(log.NewNopLogger(), bdir)
+		testutil.Ok(t, err)
+		testutil.Equals(t, int64(4), stats.Series)
+		testutil.Assert(t, stats.Samples < b.NumSamples()/10, "expected aggregated samples")
+	})
+}
+
+func TestMatchSpecs(t *testing.T) {
+	h := durToMilis(time.Hour)
+	meta := func(mint, maxt int64, cluster string, level int) *metadata.Meta {
+		return &metadata.Meta{
+			BlockMeta: tsdb.BlockMeta{ULID: ulid.MustNew(uint64(mint), nil), MinTime: mint, MaxTime: maxt, Compaction: tsdb.BlockMetaCompaction{Level: level}},
+			Thanos:    metadata.Thanos{Labels: map[string]string{"cluster": cluster}},
+		}
+	}
+	spec := func(mint, maxt int64, cluster string, level int) BlockSpec {
+		return BlockSpec{Meta: *meta(mint, maxt, cluster, level)}
+	}
+
+	metas := []*metadata.Meta{
+		meta(0, 48*h, "one", 3),
+		meta(46*h, 48*h, "one", 1),
+		meta(0, 48*h, "two", 3),
+		meta(48*h, 96*h, "one", 3),
+	}
+	testutil.Equals(t, []int{1, 0, -1, -1}, MatchSpecs(metas, []BlockSpec{
+		// Overlapping block matches the 2h block, not the 48h one.
+		spec(46*h, 48*h, "one", 0),
+		spec(0, 48*h, "one", 0),
+		spec(0, 48*h, "three", 0),
+		spec(48*h, 96*h, "one", 4),
+	}))
+
+	// Block with spec hash matches its spec regardless of time range.
+	s := spec(0, 2*h, "one", 0)
+	hash, err := s.Hash()
+	testutil.Ok(t, err)
+	metas[3].Compaction.Hints = []string{specHashHint + hash}
+	testutil.Equals(t, []int{-1, -1, 0, 1}, MatchSpecs(metas, []BlockSpec{spec(0, 48*h, "two", 0), s}))
+}
@@ -3,6 +3,8 @@ package blockgen
 import (
 	"context"
 	"math"
+	"os"
+	"path/filepath"
 	"runtime"
 	"time"
 
@@ -15,6 +17,8 @@ import (
 	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/wlog"
+	"github.com/thanos-io/thanos/pkg/block/metadata"
 )
 
 var _ Writer = &BlockWriter{}
@@ -27,7 +31,18 @@ type BlockWriter struct {
 	// dir is output directory, given to us as arg.
 	dir string
 
-	head *tsdb.Head
+	opts BlockWriterOptions
+
+	// headDir is a temporary directory for head chunks mmapped to disk.
+	headDir string
+	head    *tsdb.Head
+}
+
+// BlockWriterOptions configures BlockWriter.
+type BlockWriterOptions struct {
+	// OutOfOrderTimeWindow allows appending samples older than the newest sample of the head, of any series, by up to
+	// given duration. Older samples are dropped on commit. Out-of-order samples are merged into the same block on Flush.
+	OutOfOrderTimeWindow time.Duration
 }
 
 // NewTSDBBlockWriter create new TSDB block writer.
@@ -52,10 +67,11 @@ type BlockWriter struct {
 // Note that the writer will not check if the target directory exists or
 // contains anything at all. It is the caller's responsibility to
 // ensure that the resulting blocks do not overlap etc.
-func NewTSDBBlockWriter(logger log.Logger, dir string) (*BlockWriter, error) {
+func NewTSDBBlockWriter(logger log.Logger, dir string, opts BlockWriterOptions) (*BlockWriter, error) {
 	res := &BlockWriter{
 		logger: logger,
 		dir:    dir,
+		opts:   opts,
 	}
 
 	if err := res.initHeadAndAppender(); err != nil {
@@ -78,13 +94,27 @@ func (w *BlockWriter) Flush() (ulid.ULID, error) {
 		return ulid.ULID{}, errors.Wrap(err, "writeHeadToDisk")
 	}
 
-	if err := w.head.Close(); err != nil {
-		return ulid.ULID{}, errors.Wrap(err, "close head")
+	if err := w.Close(); err != nil {
+		return ulid.ULID{}, err
 	}
-
 	return id, nil
 }
 
+// Close implements Writer interface. It closes the head and removes its directory.
+func (w *BlockWriter) Close() error {
+	if w.head == nil {
+		return nil
+	}
+	if err := w.head.Close(); err != nil {
+		return errors.Wrap(err, "close head")
+	}
+	w.head = nil
+	if err := os.RemoveAll(w.headDir); err != nil {
+		return errors.Wrap(err, "remove head dir")
+	}
+	return nil
+}
+
 // initHeadAndAppender creates and initialises new head and appender.
 func (w *BlockWriter) initHeadAndAppender() error {
 	logger := w.logger
@@ -99,7 +129,29 @@ func (w *BlockWriter) initHeadAndAppender() error {
 	// Since we don't have info about block size here, set it to large number.
 	opts := tsdb.DefaultHeadOptions()
 	opts.ChunkRange = durToMilis(9999 * time.Hour)
-	h, err := tsdb.NewHead(nil, logger, nil, opts, nil)
+	opts.EnableNativeHistograms.Store(true)
+
+	// Head mmaps full chunks to disk. Keep them in the output directory rather than the current one.
+	if err := os.MkdirAll(w.dir, os.ModePerm); err != nil {
+		return errors.Wrap(err, "create dir")
+	}
+	headDir, err := os.MkdirTemp(w.dir, "blockgen-head-")
+	if err != nil {
+		return errors.Wrap(err, "create head dir")
+	}
+	w.headDir = headDir
+	opts.ChunkDirRoot = headDir
+
+	// Out-of-order chunks can be compacted only from a head with WBL, so keep it in the head directory too.
+	var wbl *wlog.WL
+	if w.opts.OutOfOrderTimeWindow > 0 {
+		opts.OutOfOrderTimeWindow.Store(w.opts.OutOfOrderTimeWindow.Milliseconds())
+		wbl, err = wlog.NewSize(logger, nil, filepath.Join(headDir, wlog.WblDirName), wlog.DefaultSegmentSize, false)
+		if err != nil {
+			return errors.Wrap(err, "create wbl")
+		}
+	}
+	h, err := tsdb.NewHead(nil, logger, nil, wbl, opts, nil)
 	if err != nil {
 		return errors.Wrap(err, "tsdb.NewHead")
 	}
@@ -141,5 +193,50 @@ func (w *BlockWriter) writeHeadToDisk() (ulid.ULID, error) {
 		return ulid.ULID{}, errors.Wrap(err, "create leveled compactor")
 	}
 
-	return compactor.Write(w.dir, w.head, mint, maxt+1, nil)
+	id, err := compactor.Write(w.dir, w.head, mint, maxt+1, nil)
+	if err != nil || w.opts.OutOfOrderTimeWindow <= 0 {
+		return id, err
+	}
+	return w.mergeOutOfOrder(compactor, id)
+}
+
+// mergeOutOfOrder writes out-of-order chunks of the head into a separate block and merges it with the in-order block
+// of given ID, so Flush still produces a single block.
+func (w *BlockWriter) mergeOutOfOrder(compactor *tsdb.LeveledCompactor, id ulid.ULID) (ulid.ULID, error) {
+	oooHead, err := tsdb.NewOOOCompactionHead(w.head)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "create out-of-order compaction head")
+	}
+	if oooHead.MinTime() > oooHead.MaxTime() {
+		// No out-of-order samples.
+		return id, nil
+	}
+
+	mint, maxt := oooHead.MinTime(), oooHead.MaxTime()
+	oooID, err := compactor.Write(w.dir, oooHead.CloneForTimeRange(mint, maxt), mint, maxt+1, nil)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write out-of-order block")
+	}
+
+	dirs := []string{filepath.Join(w.dir, id.String()), filepath.Join(w.dir, oooID.String())}
+	merged, err := compactor.Compact(w.dir, dirs, nil)
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "merge out-of-order block")
+	}
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir); err != nil {
+			return ulid.ULID{}, errors.Wrap(err, "remove merged block")
+		}
+	}
+
+	// Present the result as a freshly flushed block, not as a compaction of removed blocks.
+	meta, err := metadata.ReadFromDir(filepath.Join(w.dir, merged.String()))
+	if err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "read merged meta")
+	}
+	meta.Compaction = tsdb.BlockMetaCompaction{Level: 1, Sources: []ulid.ULID{merged}}
+	if err := meta.WriteToDir(w.logger, filepath.Join(w.dir, merged.String())); err != nil {
+		return ulid.ULID{}, errors.Wrap(err, "write merged meta")
+	}
+	return merged, nil
 }
@@ -6,9 +6,75 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/storage"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
-func Append(ctx context.Context, goroutines int, appendable storage.Appendable, series SeriesSet) error {
+// progressBatch is the number of samples appended before progress is reported, so long series report progress too.
+const progressBatch = 1000
+
+type appendOpts struct {
+	progress    []ProgressHook
+	fingerprint *Fingerprint
+
+	commitSamples, commitSeries int
+	maxPendingSamples           int64
+}
+
+// AppendOption configures Append.
+type AppendOption func(*appendOpts)
+
+// WithProgressHook reports progress of Append to given hook. It can be given multiple times to report to more hooks.
+func WithProgressHook(hook ProgressHook) AppendOption {
+	return func(o *appendOpts) { o.progress = append(o.progress, hook) }
+}
+
+func (o appendOpts) appended(series, samples int) {
+	for _, p := range o.progress {
+		p.Appended(series, samples)
+	}
+}
+
+// WithFingerprint adds all appended series to given fingerprint.
+func WithFingerprint(f *Fingerprint) AppendOption {
+	return func(o *appendOpts) { o.fingerprint = f }
+}
+
+// WithCommitBatch makes each worker commit its appender after given number of samples or series, whichever comes
+// first, instead of only once at the end. This bounds memory of uncommitted samples. Zero disables given limit.
+//
+// Appendable has to accept samples older than the newest committed sample of any series. Prometheus TSDB head rejects
+// samples older than half of the block range from it and, with out-of-order window, drops samples older than the
+// window on commit without error. blockgen.Generate sizes the window of BlockWriter to the whole block and checks
+// that the block has all appended samples.
+func WithCommitBatch(samples, series int) AppendOption {
+	return func(o *appendOpts) { o.commitSamples, o.commitSeries = samples, series }
+}
+
+// WithMaxPendingSamples limits the number of uncommitted samples of all workers together. A worker that would exceed
+// the limit commits its samples and waits until other workers commit theirs. It requires the same from appendable
+// as WithCommitBatch. Zero means no limit.
+func WithMaxPendingSamples(samples int64) AppendOption {
+	return func(o *appendOpts) { o.maxPendingSamples = samples }
+}
+
+// Append appends all series from given set using given number of goroutines, each with its own appender.
+func Append(ctx context.Context, goroutines int, appendable storage.Appendable, series SeriesSet, opts ...AppendOption) error {
+	o := appendOpts{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var (
+		pending      *semaphore.Weighted
+		pendingBatch = int64(progressBatch)
+	)
+	if o.maxPendingSamples > 0 {
+		pending = semaphore.NewWeighted(o.maxPendingSamples)
+		if o.maxPendingSamples < pendingBatch {
+			pendingBatch = o.maxPendingSamples
+		}
+	}
+
 	g, gctx := errgroup.WithContext(ctx)
 
 	workBuffer := make(chan Series)
@@ -19,12 +85,34 @@ func Append(ctx context.Context, goroutines int, appendable storage.Appendable,
 				s   Series
 				err error
 				ok  bool
+
+				// pendingSamples and pendingSeries are appended, but not committed yet.
+				pendingSamples, pendingSeries int
+				// held is acquired from pending semaphore, credit is the part of it not used by samples yet.
+				held, credit int64
 			)
 
-			// Commit just once to improve time.
-			// NOTE(bwplotka): Profile memory consequence of this.
+			commit := func() error {
+				if err := app.Commit(); err != nil {
+					return errors.Wrap(err, "commit")
+				}
+				app = appendable.Appender(gctx)
+				pendingSamples, pendingSeries = 0, 0
+				if held > 0 {
+					pending.Release(held)
+					held, credit = 0, 0
+				}
+				return nil
+			}
+
+			// By default, commit just once to improve time.
 			// Ignore error as Flush commits as well (is that enough?)
-			defer func() { _ = app.Commit() }()
+			defer func() {
+				_ = app.Commit()
+				if held > 0 {
+					pending.Release(held)
+				}
+			}()
 
 			for {
 				select {
@@ -38,13 +126,49 @@ func Append(ctx context.Context, goroutines int, appendable storage.Appendable,
 
 				ref := storage.SeriesRef(0)
 				iter := s.Iterator()
+				hiter, isHistogram := iter.(HistogramIterator)
+				eiter, hasExemplars := iter.(ExemplarIterator)
+				mseries, hasMetadata := s.(MetadataSeries)
+				samples := 0
+
+				var hash *seriesHash
+				if o.fingerprint != nil {
+					hash = newSeriesHash(s.Labels())
+				}
 
 				for iter.Next() {
 					if gctx.Err() != nil {
 						return gctx.Err()
 					}
-					t, v := iter.At()
-					ref, err = app.Append(ref, s.Labels(), t, v)
+					if pending != nil && credit == 0 {
+						if !pending.TryAcquire(pendingBatch) {
+							// Commit own samples first, so workers never wait for each other while holding samples.
+							if pendingSamples > 0 {
+								if err := commit(); err != nil {
+									return err
+								}
+							}
+							if err := pending.Acquire(gctx, pendingBatch); err != nil {
+								return err
+							}
+						}
+						held += pendingBatch
+						credit = pendingBatch
+					}
+
+					if isHistogram {
+						t, h := hiter.AtHistogram()
+						ref, err = app.AppendHistogram(ref, s.Labels(), t, h)
+						if hash != nil {
+							hash.histogram(t, h)
+						}
+					} else {
+						t, v := iter.At()
+						ref, err = app.Append(ref, s.Labels(), t, v)
+						if hash != nil {
+							hash.sample(t, v)
+						}
+					}
 					if err != nil {
 						if rerr := app.Rollback(); rerr != nil {
 							err = errors.Wrapf(err, "rollback failed: %v", rerr)
@@ -52,6 +176,48 @@ func Append(ctx context.Context, goroutines int, appendable storage.Appendable,
 
 						return errors.Wrap(err, "add sample")
 					}
+					if pending != nil {
+						credit--
+					}
+					pendingSamples++
+					if samples++; samples == progressBatch {
+						o.appended(0, samples)
+						samples = 0
+					}
+
+					// Series has to exist before metadata can be attached, so update it after the first sample.
+					if hasMetadata {
+						hasMetadata = false
+						if _, err = app.UpdateMetadata(ref, s.Labels(), mseries.Metadata()); err != nil {
+							if rerr := app.Rollback(); rerr != nil {
+								err = errors.Wrapf(err, "rollback failed: %v", rerr)
+							}
+
+							return errors.Wrap(err, "update metadata")
+						}
+					}
+
+					if hasExemplars {
+						if e, ok := eiter.AtExemplar(); ok {
+							if hash != nil {
+								hash.exemplar(e)
+							}
+							// Exemplar storage does not accept out-of-order exemplars, skip them as Prometheus scrape does.
+							if _, err = app.AppendExemplar(ref, s.Labels(), e); err != nil && errors.Cause(err) != storage.ErrOutOfOrderExemplar {
+								if rerr := app.Rollback(); rerr != nil {
+									err = errors.Wrapf(err, "rollback failed: %v", rerr)
+								}
+
+								return errors.Wrap(err, "add exemplar")
+							}
+						}
+					}
+
+					if o.commitSamples > 0 && pendingSamples >= o.commitSamples {
+						if err := commit(); err != nil {
+							return err
+						}
+					}
 				}
 
 				if err := iter.Err(); err != nil {
@@ -60,13 +226,21 @@ func Append(ctx context.Context, goroutines int, appendable storage.Appendable,
 					}
 					return errors.Wrap(err, "iter")
 				}
+				o.appended(1, samples)
+				if hash != nil {
+					o.fingerprint.add(hash.sum())
+				}
+				if pendingSeries++; o.commitSeries > 0 && pendingSeries >= o.commitSeries {
+					if err := commit(); err != nil {
+						return err
+					}
+				}
 			}
 		})
 	}
 
 	for series.Next() {
 		select {
-		// TODO(bwplotka): Add some progress bar.
 		case workBuffer <- series.At():
 		case <-gctx.Done():
 			return errors.Wrapf(g.Wait(), "err: %s", gctx.Err())
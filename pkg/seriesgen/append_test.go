@@ -9,12 +9,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/efficientgo/core/testutil"
 	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
 	"github.com/prometheus/prometheus/model/labels"
 	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/textparse"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/storage"
-	"github.com/thanos-io/thanos/pkg/testutil"
 )
 
 type testSet struct {
@@ -48,8 +50,11 @@ func (s *testSet) At() Series { return s.curr }
 func (s *testSet) Err() error { return nil }
 
 type testAppendable struct {
-	mtx     sync.Mutex
-	samples map[uint64][]sample
+	mtx        sync.Mutex
+	samples    map[uint64][]sample
+	histograms map[uint64][]*histogram.Histogram
+	exemplars  map[uint64][]exemplar.Exemplar
+	metadata   map[uint64][]metadata.Metadata
 }
 
 func (a *testAppendable) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
@@ -64,12 +69,38 @@ func (a *testAppendable) Append(ref storage.SeriesRef, l labels.Labels, t int64,
 	return storage.SeriesRef(hash), nil
 }
 
+func (a *testAppendable) AppendHistogram(ref storage.SeriesRef, l labels.Labels, t int64, h *histogram.Histogram) (storage.SeriesRef, error) {
+	hash := uint64(ref)
+	if hash == 0 {
+		hash = l.Hash()
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.histograms[hash] = append(a.histograms[hash], h)
+	return storage.SeriesRef(hash), nil
+}
+
 func (a *testAppendable) AppendExemplar(ref storage.SeriesRef, l labels.Labels, e exemplar.Exemplar) (storage.SeriesRef, error) {
-	return 0, nil
+	if a.exemplars == nil {
+		return 0, nil
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.exemplars[uint64(ref)] = append(a.exemplars[uint64(ref)], e)
+	return ref, nil
 }
 
 func (a *testAppendable) UpdateMetadata(ref storage.SeriesRef, l labels.Labels, m metadata.Metadata) (storage.SeriesRef, error) {
-	return 0, nil
+	if a.metadata == nil {
+		return 0, nil
+	}
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	a.metadata[uint64(ref)] = append(a.metadata[uint64(ref)], m)
+	return ref, nil
 }
 
 func (a *testAppendable) Commit() error {
@@ -89,7 +120,7 @@ func TestAppend(t *testing.T) {
 		count: 2,
 	}
 
-	a := &testAppendable{samples: map[uint64][]sample{}}
+	a := &testAppendable{samples: map[uint64][]sample{}, histograms: map[uint64][]*histogram.Histogram{}}
 	testutil.Ok(t, Append(context.Background(), 2*runtime.GOMAXPROCS(0), a, s))
 	testutil.Equals(t, map[uint64][]sample{
 		0x6577cd4df75e4415: {
@@ -109,3 +140,140 @@ func TestAppend(t *testing.T) {
 	}, a.samples)
 
 }
+
+func TestAppend_Exemplars(t *testing.T) {
+	opts := Characteristics{
+		ScrapeInterval: 10 * time.Second,
+		Min:            100,
+		Max:            200,
+		Exemplars: ExemplarCharacteristics{
+			Probability:      1,
+			ValueCorrelation: 1,
+		},
+	}
+	random := rand.New(rand.NewSource(1))
+	s := &listSet{series: []Series{
+		NewSeriesGen(labels.FromStrings("a", "1"), WithCharacteristics(random, NewValGen(random, 0, 30000, opts), 0, 30000, opts)),
+	}}
+
+	a := &testAppendable{samples: map[uint64][]sample{}, exemplars: map[uint64][]exemplar.Exemplar{}}
+	testutil.Ok(t, Append(context.Background(), 1, a, s))
+
+	ref := labels.FromStrings("a", "1").Hash()
+	testutil.Equals(t, 4, len(a.samples[ref]))
+	testutil.Equals(t, 4, len(a.exemplars[ref]))
+	for i, e := range a.exemplars[ref] {
+		testutil.Equals(t, a.samples[ref][i].T, e.Ts)
+		testutil.Equals(t, a.samples[ref][i].V, e.Value)
+	}
+}
+
+func TestAppend_Metadata(t *testing.T) {
+	opts := Characteristics{ScrapeInterval: 10 * time.Second, Max: 200}
+	random := rand.New(rand.NewSource(1))
+	lset := labels.FromStrings("__name__", "http_requests_total")
+	m := NewMetadata(textparse.MetricTypeCounter, lset, "", "")
+	s := &listSet{series: []Series{
+		WithMetadata(NewSeriesGen(lset, NewCounterGen(random, 0, 30000, opts)), m),
+		NewSeriesGen(labels.FromStrings("__name__", "up"), NewGaugeGen(random, 0, 30000, opts)),
+	}}
+
+	a := &testAppendable{samples: map[uint64][]sample{}, metadata: map[uint64][]metadata.Metadata{}}
+	testutil.Ok(t, Append(context.Background(), 1, a, s))
+
+	testutil.Equals(t, map[uint64][]metadata.Metadata{
+		lset.Hash(): {{Type: textparse.MetricTypeCounter, Help: "Generated counter http_requests_total."}},
+	}, a.metadata)
+}
+
+// batchAppendable tracks commits and uncommitted samples of all its appenders.
+type batchAppendable struct {
+	*testAppendable
+
+	mtx                          sync.Mutex
+	commits, pending, maxPending int
+}
+
+func (a *batchAppendable) Appender(_ context.Context) storage.Appender {
+	return &batchAppender{testAppendable: a.testAppendable, parent: a}
+}
+
+type batchAppender struct {
+	*testAppendable
+
+	parent  *batchAppendable
+	pending int
+}
+
+func (a *batchAppender) Append(ref storage.SeriesRef, l labels.Labels, t int64, v float64) (storage.SeriesRef, error) {
+	a.parent.mtx.Lock()
+	a.pending++
+	a.parent.pending++
+	if a.parent.pending > a.parent.maxPending {
+		a.parent.maxPending = a.parent.pending
+	}
+	a.parent.mtx.Unlock()
+	return a.testAppendable.Append(ref, l, t, v)
+}
+
+func (a *batchAppender) Commit() error {
+	a.parent.mtx.Lock()
+	defer a.parent.mtx.Unlock()
+
+	if a.pending > 0 {
+		a.parent.commits++
+	}
+	a.parent.pending -= a.pending
+	a.pending = 0
+	return nil
+}
+
+func TestAppend_CommitBatch(t *testing.T) {
+	for _, tcase := range []struct {
+		name       string
+		goroutines int
+		opts       []AppendOption
+
+		expectedCommits    int
+		expectedMaxPending int
+	}{
+		{name: "no batching", goroutines: 1, expectedCommits: 1, expectedMaxPending: 20},
+		{name: "by samples", goroutines: 1, opts: []AppendOption{WithCommitBatch(2, 0)}, expectedCommits: 10, expectedMaxPending: 2},
+		{name: "by series", goroutines: 1, opts: []AppendOption{WithCommitBatch(0, 1)}, expectedCommits: 4, expectedMaxPending: 5},
+		{name: "by samples and series", goroutines: 1, opts: []AppendOption{WithCommitBatch(3, 1)}, expectedCommits: 8, expectedMaxPending: 3},
+		{name: "max pending", goroutines: 4, opts: []AppendOption{WithMaxPendingSamples(3)}, expectedMaxPending: 3},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			a := &batchAppendable{testAppendable: &testAppendable{samples: map[uint64][]sample{}}}
+			testutil.Ok(t, Append(context.Background(), tcase.goroutines, a, &testSet{count: 4}, tcase.opts...))
+
+			var samples int
+			for _, s := range a.samples {
+				samples += len(s)
+			}
+			testutil.Equals(t, 20, samples)
+			testutil.Equals(t, 0, a.pending)
+			testutil.Assert(t, a.maxPending <= tcase.expectedMaxPending, "max pending %v, expected at most %v", a.maxPending, tcase.expectedMaxPending)
+			if tcase.expectedCommits > 0 {
+				testutil.Equals(t, tcase.expectedCommits, a.commits)
+			}
+		})
+	}
+}
+
+type listSet struct {
+	series []Series
+	curr   Series
+}
+
+func (s *listSet) Next() bool {
+	if len(s.series) == 0 {
+		return false
+	}
+	s.curr, s.series = s.series[0], s.series[1:]
+	return true
+}
+
+func (s *listSet) At() Series { return s.curr }
+
+func (s *listSet) Err() error { return nil }
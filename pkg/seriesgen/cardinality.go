@@ -0,0 +1,288 @@
+package seriesgen
+
+import (
+	"math/rand"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// CardinalityModel describes label names and values of series, so series sets with specific index shapes can be
+// generated without enumerating labels by hand.
+type CardinalityModel struct {
+	// Labels are label names with their values. Labels with parent have to be defined after their parent.
+	Labels []LabelModel `yaml:"labels"`
+	// Series is the number of unique series to generate. If 0, all combinations of label values are generated.
+	Series int `yaml:"series"`
+}
+
+// LabelModel describes values of a single label.
+type LabelModel struct {
+	Name string `yaml:"name"`
+	// Values is the number of distinct values. For labels with parent, it is the number of values per parent value.
+	Values int `yaml:"values"`
+	// Distribution of series across values, UNIFORM (default) or ZIPF, where the first value is the most frequent.
+	// Used only if not all combinations of label values are generated.
+	Distribution Distribution `yaml:"distribution"`
+	// Parent makes the label hierarchical, e.g. namespace -> pod -> container. Values are then unique per parent value
+	// and prefixed with it, so each value occurs only with a single parent value.
+	Parent string `yaml:"parent"`
+	// Prefix of values. For SEQUENTIAL values it is followed by value number and if empty, label name and "-" is used,
+	// e.g. "pod-3".
+	Prefix string `yaml:"prefix"`
+
+	// Shape of values: SEQUENTIAL (default), RANDOM, UUID, IP or PATH.
+	Shape ValueShape `yaml:"shape"`
+	// Length of RANDOM and PATH values in characters, 16 if not specified.
+	Length LengthCharacteristics `yaml:"length"`
+	// Charset of RANDOM and PATH values: ALPHANUMERIC (default), HEX or UNICODE.
+	Charset Charset `yaml:"charset"`
+	// CommonPrefixRatio is the part of each RANDOM, PATH or UUID value shared by all values of the label, or for IP values,
+	// the part of address bits in common (e.g. 0.75 makes all values within /24 subnet). Prefix of RANDOM, PATH and UUID
+	// values is shortened if needed, so their last characters make them unique.
+	CommonPrefixRatio float64 `yaml:"commonPrefixRatio"`
+}
+
+func (m CardinalityModel) validate() error {
+	if len(m.Labels) == 0 {
+		return errors.New("cardinality model requires at least one label")
+	}
+	seen := map[string]struct{}{}
+	for _, l := range m.Labels {
+		if l.Name == "" {
+			return errors.New("label name cannot be empty")
+		}
+		if _, ok := seen[l.Name]; ok {
+			return errors.Errorf("label %s defined twice", l.Name)
+		}
+		if l.Values <= 0 {
+			return errors.Errorf("label %s requires at least one value, got %d", l.Name, l.Values)
+		}
+		switch l.Distribution {
+		case "", UniformDistribution, ZipfDistribution:
+		default:
+			return errors.Errorf("unsupported distribution of label %s: %s", l.Name, string(l.Distribution))
+		}
+		if _, ok := seen[l.Parent]; l.Parent != "" && !ok {
+			return errors.Errorf("parent %s of label %s has to be defined before it", l.Parent, l.Name)
+		}
+		if _, err := newLabelValues(0, l); err != nil {
+			return err
+		}
+		seen[l.Name] = struct{}{}
+	}
+	if m.Series < 0 || m.Series > m.combinations() {
+		return errors.Errorf("cardinality model has %d label value combinations, %d series requested", m.combinations(), m.Series)
+	}
+	return nil
+}
+
+// combinations returns the number of all combinations of label values, capped at max int.
+func (m CardinalityModel) combinations() int {
+	const maxInt = int(^uint(0) >> 1)
+
+	n := 1
+	for _, l := range m.Labels {
+		if l.Values > 0 && n > maxInt/l.Values {
+			return maxInt
+		}
+		n *= l.Values
+	}
+	return n
+}
+
+// NumSeries returns the number of series generated from the model.
+func (m CardinalityModel) NumSeries() int {
+	if m.Series > 0 {
+		return m.Series
+	}
+	return m.combinations()
+}
+
+// SeriesFactory creates series for given labels, e.g. a single series or a whole metric family.
+type SeriesFactory func(lset labels.Labels) ([]Series, error)
+
+// CardinalitySet is a SeriesSet with labels generated from a cardinality model.
+type CardinalitySet struct {
+	model  CardinalityModel
+	common labels.Labels
+	create SeriesFactory
+
+	// idx are value numbers of each label of the current series.
+	idx    []int
+	zipfs  []*rand.Zipf
+	parent []int
+	values []*labelValues
+	seen   map[uint64]struct{}
+	done   int
+	// attempts is the number of sampled combinations, including already seen ones.
+	attempts int
+	// remaining are shuffled combinations not sampled yet, which are used after most combinations were sampled.
+	remaining []uint64
+
+	curr    Series
+	pending []Series
+	err     error
+
+	random *rand.Rand
+}
+
+// NewCardinalitySet returns series set with labels generated from given model, merged with common labels.
+// Series for each label set are created by given factory.
+func NewCardinalitySet(random *rand.Rand, model CardinalityModel, common labels.Labels, create SeriesFactory) *CardinalitySet {
+	s := &CardinalitySet{
+		model:  model,
+		common: common,
+		create: create,
+		idx:    make([]int, len(model.Labels)),
+		zipfs:  make([]*rand.Zipf, len(model.Labels)),
+		parent: make([]int, len(model.Labels)),
+		values: make([]*labelValues, len(model.Labels)),
+		seen:   map[uint64]struct{}{},
+		random: random,
+	}
+	if s.err = model.validate(); s.err != nil {
+		return s
+	}
+
+	pos := map[string]int{}
+	for i, l := range model.Labels {
+		pos[l.Name] = i
+		s.parent[i] = -1
+		if l.Parent != "" {
+			s.parent[i] = pos[l.Parent]
+		}
+		var seed int64
+		if l.Shape != "" && l.Shape != SequentialShape {
+			seed = random.Int63()
+		}
+		if s.values[i], s.err = newLabelValues(seed, l); s.err != nil {
+			return s
+		}
+		if l.Distribution == ZipfDistribution && l.Values > 1 {
+			s.zipfs[i] = rand.NewZipf(random, zipfExponent, 1, uint64(l.Values-1))
+		}
+	}
+	// All combinations are enumerated starting from the last one, so the first Next starts at zeros.
+	for i := range s.idx {
+		s.idx[i] = model.Labels[i].Values - 1
+	}
+	return s
+}
+
+func (s *CardinalitySet) Next() bool {
+	if s.err != nil {
+		return false
+	}
+	if len(s.pending) > 0 {
+		s.curr, s.pending = s.pending[0], s.pending[1:]
+		return true
+	}
+	if s.done >= s.model.NumSeries() {
+		return false
+	}
+
+	if s.model.Series > 0 && s.model.Series < s.model.combinations() {
+		if err := s.sample(); err != nil {
+			s.err = err
+			return false
+		}
+	} else {
+		s.enumerate()
+	}
+	s.done++
+
+	series, err := s.create(s.labels())
+	if err != nil {
+		s.err = err
+		return false
+	}
+	if len(series) == 0 {
+		return s.Next()
+	}
+	s.curr, s.pending = series[0], series[1:]
+	return true
+}
+
+// enumerate moves to the next combination of label values, with the last label changing the fastest.
+func (s *CardinalitySet) enumerate() {
+	for i := len(s.idx) - 1; i >= 0; i-- {
+		if s.idx[i]++; s.idx[i] < s.model.Labels[i].Values {
+			return
+		}
+		s.idx[i] = 0
+	}
+}
+
+const (
+	// sampleEnumerateRatio is the ratio of sampled combinations to all ones after which the rest of series is taken
+	// from shuffled combinations not sampled yet, as new ones are found by sampling rarely.
+	sampleEnumerateRatio = 0.5
+	// maxSampleAttempts is the maximum number of sampled combinations per requested series.
+	maxSampleAttempts = 100
+)
+
+// sample draws random combinations of label values until a new one is found. Once most combinations were sampled,
+// it switches to shuffled remaining combinations, which ignores distributions of values.
+func (s *CardinalitySet) sample() error {
+	combinations := s.model.combinations()
+	if s.remaining == nil && float64(len(s.seen)) >= sampleEnumerateRatio*float64(combinations) {
+		s.remaining = make([]uint64, 0, combinations-len(s.seen))
+		for key := uint64(0); key < uint64(combinations); key++ {
+			if _, ok := s.seen[key]; !ok {
+				s.remaining = append(s.remaining, key)
+			}
+		}
+		s.random.Shuffle(len(s.remaining), func(i, j int) {
+			s.remaining[i], s.remaining[j] = s.remaining[j], s.remaining[i]
+		})
+		s.seen = nil
+	}
+	if s.remaining != nil {
+		key := s.remaining[len(s.remaining)-1]
+		s.remaining = s.remaining[:len(s.remaining)-1]
+		for i := len(s.idx) - 1; i >= 0; i-- {
+			values := uint64(s.model.Labels[i].Values)
+			s.idx[i], key = int(key%values), key/values
+		}
+		return nil
+	}
+
+	for ; s.attempts < maxSampleAttempts*s.model.Series; s.attempts++ {
+		for i, l := range s.model.Labels {
+			if s.zipfs[i] != nil {
+				s.idx[i] = int(s.zipfs[i].Uint64())
+				continue
+			}
+			s.idx[i] = s.random.Intn(l.Values)
+		}
+
+		// Number of the combination, unique unless there are more than 2^64 combinations.
+		var key uint64
+		for i, v := range s.idx {
+			key = key*uint64(s.model.Labels[i].Values) + uint64(v)
+		}
+		if _, ok := s.seen[key]; !ok {
+			s.seen[key] = struct{}{}
+			return nil
+		}
+	}
+	return errors.Errorf("no new combination of label values found after %d attempts, %d of %d series sampled; request fewer series or use UNIFORM distribution", s.attempts, len(s.seen), s.model.Series)
+}
+
+func (s *CardinalitySet) labels() labels.Labels {
+	b := labels.NewBuilder(s.common)
+	values := make([]string, len(s.idx))
+	for i, l := range s.model.Labels {
+		values[i] = s.values[i].get(s.idx[i])
+		if p := s.parent[i]; p >= 0 {
+			values[i] = values[p] + "-" + values[i]
+		}
+		b.Set(l.Name, values[i])
+	}
+	return b.Labels(nil)
+}
+
+func (s *CardinalitySet) At() Series { return s.curr }
+
+func (s *CardinalitySet) Err() error { return s.err }
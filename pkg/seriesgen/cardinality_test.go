@@ -0,0 +1,132 @@
+package seriesgen
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+func collectCardinality(t *testing.T, model CardinalityModel) []labels.Labels {
+	t.Helper()
+
+	set := NewCardinalitySet(rand.New(rand.NewSource(1)), model, labels.FromStrings("__name__", "up"), func(lset labels.Labels) ([]Series, error) {
+		return []Series{NewSeriesGen(lset, nil)}, nil
+	})
+	var res []labels.Labels
+	for set.Next() {
+		res = append(res, set.At().Labels())
+	}
+	testutil.Ok(t, set.Err())
+	return res
+}
+
+func TestCardinalitySet_AllCombinations(t *testing.T) {
+	model := CardinalityModel{Labels: []LabelModel{
+		{Name: "namespace", Values: 2},
+		{Name: "pod", Values: 3, Parent: "namespace"},
+		{Name: "container", Values: 2, Parent: "pod", Prefix: "c"},
+	}}
+	testutil.Equals(t, 12, model.NumSeries())
+
+	got := collectCardinality(t, model)
+	testutil.Equals(t, 12, len(got))
+	testutil.Equals(t, labels.FromStrings(
+		"__name__", "up",
+		"container", "namespace-0-pod-0-c0",
+		"namespace", "namespace-0",
+		"pod", "namespace-0-pod-0",
+	), got[0])
+	testutil.Equals(t, labels.FromStrings(
+		"__name__", "up",
+		"container", "namespace-1-pod-2-c1",
+		"namespace", "namespace-1",
+		"pod", "namespace-1-pod-2",
+	), got[11])
+
+	seen := map[string]struct{}{}
+	pods := map[string]struct{}{}
+	for _, lset := range got {
+		seen[lset.String()] = struct{}{}
+		pods[lset.Get("pod")] = struct{}{}
+		testutil.Assert(t, strings.HasPrefix(lset.Get("pod"), lset.Get("namespace")+"-"), "pod %v not within namespace", lset)
+	}
+	testutil.Equals(t, 12, len(seen))
+	testutil.Equals(t, 6, len(pods))
+}
+
+func TestCardinalitySet_Sampled(t *testing.T) {
+	model := CardinalityModel{
+		Labels: []LabelModel{
+			{Name: "handler", Values: 20, Distribution: ZipfDistribution},
+			{Name: "instance", Values: 50},
+		},
+		Series: 300,
+	}
+	got := collectCardinality(t, model)
+	testutil.Equals(t, 300, len(got))
+
+	seen := map[string]struct{}{}
+	handlers := map[string]int{}
+	for _, lset := range got {
+		seen[lset.String()] = struct{}{}
+		handlers[lset.Get("handler")]++
+	}
+	testutil.Equals(t, 300, len(seen))
+	// Zipf makes the first value the most frequent one.
+	testutil.Assert(t, handlers["handler-0"] > handlers["handler-10"], "expected skew towards first value, got %v", handlers)
+}
+
+func TestCardinalitySet_ZipfFullCardinality(t *testing.T) {
+	// Rarest combinations are sampled with probability around 300^-2.2, so they have to be enumerated instead.
+	for _, series := range []int{300 * 300, 300*300 - 1} {
+		model := CardinalityModel{
+			Labels: []LabelModel{
+				{Name: "handler", Values: 300, Distribution: ZipfDistribution},
+				{Name: "instance", Values: 300, Distribution: ZipfDistribution},
+			},
+			Series: series,
+		}
+		got := collectCardinality(t, model)
+		testutil.Equals(t, series, len(got))
+
+		seen := map[string]struct{}{}
+		for _, lset := range got {
+			seen[lset.String()] = struct{}{}
+		}
+		testutil.Equals(t, series, len(seen))
+	}
+}
+
+func TestCardinalitySet_Invalid(t *testing.T) {
+	for _, tcase := range []struct {
+		model CardinalityModel
+		err   string
+	}{
+		{
+			model: CardinalityModel{},
+			err:   "cardinality model requires at least one label",
+		},
+		{
+			model: CardinalityModel{Labels: []LabelModel{{Name: "a", Values: 2}, {Name: "b", Values: 3}}, Series: 7},
+			err:   "cardinality model has 6 label value combinations, 7 series requested",
+		},
+		{
+			model: CardinalityModel{Labels: []LabelModel{{Name: "pod", Values: 2, Parent: "namespace"}, {Name: "namespace", Values: 3}}},
+			err:   "parent namespace of label pod has to be defined before it",
+		},
+		{
+			model: CardinalityModel{Labels: []LabelModel{{Name: "a", Values: 0}}},
+			err:   "label a requires at least one value, got 0",
+		},
+	} {
+		t.Run(tcase.err, func(t *testing.T) {
+			set := NewCardinalitySet(rand.New(rand.NewSource(1)), tcase.model, nil, nil)
+			testutil.Assert(t, !set.Next())
+			testutil.NotOk(t, set.Err())
+			testutil.Equals(t, tcase.err, set.Err().Error())
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+
+	"github.com/pkg/errors"
+)
+
+type Distribution string
+
+const (
+	// UniformDistribution samples values uniformly between Min and Max. This is the default.
+	UniformDistribution Distribution = "UNIFORM"
+	// NormalDistribution samples values with mean in the middle of Min and Max, and standard deviation of 1/6 of the range.
+	NormalDistribution Distribution = "NORMAL"
+	// LogNormalDistribution samples values which logarithm is normally distributed between log(Min) and log(Max). Min has to be positive.
+	LogNormalDistribution Distribution = "LOG_NORMAL"
+	// ExponentialDistribution samples Min plus exponentially distributed values with mean of 1/4 of the range.
+	ExponentialDistribution Distribution = "EXPONENTIAL"
+	// ZipfDistribution samples integers between Min and Max, with Min being the most frequent.
+	ZipfDistribution Distribution = "ZIPF"
+	// ConstantDistribution always returns Min.
+	ConstantDistribution Distribution = "CONSTANT"
+)
+
+// zipfExponent is the exponent used for ZipfDistribution.
+const zipfExponent = 1.1
+
+// valueSampler samples values configured by Characteristics.Distribution, Characteristics.Min and Characteristics.Max.
+type valueSampler struct {
+	dist     Distribution
+	min, max float64
+	integer  bool
+
+	zipf   *rand.Zipf
+	random *rand.Rand
+}
+
+func newValueSampler(random *rand.Rand, opts Characteristics) (*valueSampler, error) {
+	s := &valueSampler{dist: opts.Distribution, min: opts.Min, max: opts.Max, integer: opts.Integer, random: random}
+	switch s.dist {
+	case "", UniformDistribution, NormalDistribution, ExponentialDistribution, ConstantDistribution:
+	case LogNormalDistribution:
+		if s.min <= 0 || s.max < s.min {
+			return s, errors.Errorf("%s distribution requires 0 < min <= max, got [%v, %v]", s.dist, s.min, s.max)
+		}
+	case ZipfDistribution:
+		if s.max-s.min < 1 {
+			return s, errors.Errorf("%s distribution requires max - min >= 1, got [%v, %v]", s.dist, s.min, s.max)
+		}
+		s.zipf = rand.NewZipf(random, zipfExponent, 1, uint64(s.max-s.min))
+	default:
+		return s, errors.Errorf("unsupported distribution: %s", string(s.dist))
+	}
+	return s, nil
+}
+
+func (s *valueSampler) sample() float64 {
+	var v float64
+	switch s.dist {
+	case NormalDistribution:
+		v = (s.min+s.max)/2 + s.random.NormFloat64()*(s.max-s.min)/6
+	case LogNormalDistribution:
+		lmin, lmax := math.Log(s.min), math.Log(s.max)
+		v = math.Exp((lmin+lmax)/2 + s.random.NormFloat64()*(lmax-lmin)/6)
+	case ExponentialDistribution:
+		v = s.min + s.random.ExpFloat64()*(s.max-s.min)/4
+	case ZipfDistribution:
+		v = s.min + float64(s.zipf.Uint64())
+	case ConstantDistribution:
+		v = s.min
+	default:
+		v = s.min + s.random.Float64()*((s.max-s.min)+1)
+	}
+	return s.round(v)
+}
+
+// round rounds value if only integers are expected.
+func (s *valueSampler) round(v float64) float64 {
+	if !s.integer {
+		return v
+	}
+	return math.Round(v)
+}
@@ -0,0 +1,101 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestValGen_Distributions(t *testing.T) {
+	for _, tcase := range []struct {
+		dist     Distribution
+		min, max float64
+		integer  bool
+
+		check func(t *testing.T, sorted []float64)
+	}{
+		{
+			dist: UniformDistribution, min: 10, max: 100,
+			check: func(t *testing.T, sorted []float64) {
+				testutil.Assert(t, sorted[0] >= 10 && sorted[len(sorted)-1] < 101, "")
+			},
+		},
+		{
+			dist: NormalDistribution, min: 10, max: 100,
+			check: func(t *testing.T, sorted []float64) {
+				median := sorted[len(sorted)/2]
+				testutil.Assert(t, median > 50 && median < 60, "unexpected median %v", median)
+			},
+		},
+		{
+			dist: LogNormalDistribution, min: 1, max: 10000,
+			check: func(t *testing.T, sorted []float64) {
+				median := sorted[len(sorted)/2]
+				testutil.Assert(t, sorted[0] > 0, "")
+				testutil.Assert(t, median > 90 && median < 110, "unexpected median %v", median)
+			},
+		},
+		{
+			dist: ExponentialDistribution, min: 10, max: 50,
+			check: func(t *testing.T, sorted []float64) {
+				median := sorted[len(sorted)/2]
+				testutil.Assert(t, sorted[0] >= 10, "")
+				testutil.Assert(t, median > 16 && median < 18, "unexpected median %v", median)
+			},
+		},
+		{
+			dist: ZipfDistribution, min: 1, max: 1000,
+			check: func(t *testing.T, sorted []float64) {
+				testutil.Assert(t, sorted[0] == 1 && sorted[len(sorted)-1] <= 1000, "")
+				// Minimum is the most frequent value.
+				testutil.Assert(t, sorted[len(sorted)/10] == 1, "")
+			},
+		},
+		{
+			dist: ConstantDistribution, min: 7, max: 100,
+			check: func(t *testing.T, sorted []float64) {
+				testutil.Equals(t, sorted[0], sorted[len(sorted)-1])
+				testutil.Equals(t, 7.0, sorted[0])
+			},
+		},
+		{
+			dist: NormalDistribution, min: 0, max: 10, integer: true,
+			check: func(t *testing.T, sorted []float64) {
+				for _, v := range sorted {
+					testutil.Equals(t, math.Round(v), v)
+				}
+			},
+		},
+	} {
+		t.Run(string(tcase.dist), func(t *testing.T) {
+			g := NewValGen(rand.New(rand.NewSource(1)), 0, int64((24*time.Hour).Seconds())*1000, Characteristics{
+				ScrapeInterval: 15 * time.Second,
+				Min:            tcase.min,
+				Max:            tcase.max,
+				Distribution:   tcase.dist,
+				Integer:        tcase.integer,
+			})
+
+			var values []float64
+			for g.Next() {
+				_, v := g.At()
+				values = append(values, v)
+			}
+			testutil.Ok(t, g.Err())
+			sort.Float64s(values)
+			tcase.check(t, values)
+		})
+	}
+
+	g := NewValGen(rand.New(rand.NewSource(1)), 0, 1000, Characteristics{Distribution: LogNormalDistribution})
+	testutil.Assert(t, !g.Next(), "")
+	testutil.NotOk(t, g.Err())
+
+	g = NewValGen(rand.New(rand.NewSource(1)), 0, 1000, Characteristics{Distribution: "unknown"})
+	testutil.Assert(t, !g.Next(), "")
+	testutil.NotOk(t, g.Err())
+}
@@ -0,0 +1,137 @@
+package seriesgen
+
+import (
+	"encoding/hex"
+	"math/rand"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/value"
+)
+
+const (
+	defaultTraceIDLabel  = "trace_id"
+	defaultTraceIDLength = 32
+	spanIDLabel          = "span_id"
+	spanIDLength         = 16
+)
+
+// ExemplarIterator iterates over samples with optional exemplars.
+// Exemplars of iterators implementing it are appended together with samples.
+type ExemplarIterator interface {
+	SeriesIterator
+
+	// AtExemplar returns exemplar of the current sample. If the sample has no exemplar, ok is false.
+	AtExemplar() (e exemplar.Exemplar, ok bool)
+}
+
+// ExemplarCharacteristics configures exemplars attached to samples.
+type ExemplarCharacteristics struct {
+	// Probability of attaching an exemplar to each sample. If 0, no exemplars are generated.
+	Probability float64 `yaml:"probability"`
+
+	// TraceIDLabel is a name of the trace ID label. If empty, "trace_id" is used.
+	TraceIDLabel string `yaml:"traceIDLabel"`
+	// TraceIDLength is a number of hex characters of trace ID. If 0, 32 is used, as in W3C trace context.
+	TraceIDLength int `yaml:"traceIDLength"`
+	// SpanID adds "span_id" label with 16 hex characters.
+	SpanID bool `yaml:"spanID"`
+
+	// ValueCorrelation is a ratio [0, 1] of how much the exemplar value follows the sample value. For 1 exemplar has
+	// the sample value, for 0 it has random value between Min and Max from configured distribution.
+	ValueCorrelation float64 `yaml:"valueCorrelation"`
+}
+
+// WithExemplars wraps given iterator so it yields exemplars according to opts.Exemplars.
+// Iterator is returned unchanged if no exemplars are configured.
+func WithExemplars(random *rand.Rand, iter SeriesIterator, opts Characteristics) SeriesIterator {
+	if opts.Exemplars.Probability == 0 {
+		return iter
+	}
+
+	g := &exemplarGen{SeriesIterator: iter, opts: opts.Exemplars, random: random}
+	if g.opts.TraceIDLabel == "" {
+		g.opts.TraceIDLabel = defaultTraceIDLabel
+	}
+	if g.opts.TraceIDLength == 0 {
+		g.opts.TraceIDLength = defaultTraceIDLength
+	}
+	g.sampler, g.err = newValueSampler(random, opts)
+	if g.err == nil {
+		g.err = g.validate()
+	}
+	return g
+}
+
+type exemplarGen struct {
+	SeriesIterator
+
+	opts    ExemplarCharacteristics
+	sampler *valueSampler
+
+	e   exemplar.Exemplar
+	ok  bool
+	err error
+
+	random *rand.Rand
+}
+
+func (g *exemplarGen) validate() error {
+	if g.opts.Probability < 0 || g.opts.Probability > 1 {
+		return errors.Errorf("exemplar probability has to be within [0, 1], got %v", g.opts.Probability)
+	}
+	if g.opts.ValueCorrelation < 0 || g.opts.ValueCorrelation > 1 {
+		return errors.Errorf("exemplar value correlation has to be within [0, 1], got %v", g.opts.ValueCorrelation)
+	}
+	if !model.LabelName(g.opts.TraceIDLabel).IsValid() {
+		return errors.Errorf("exemplar trace ID label has invalid name %q", g.opts.TraceIDLabel)
+	}
+	if g.opts.TraceIDLength < 0 {
+		return errors.Errorf("exemplar trace ID length cannot be negative, got %d", g.opts.TraceIDLength)
+	}
+	if l := len(g.opts.TraceIDLabel) + g.opts.TraceIDLength; l > exemplar.ExemplarMaxLabelSetLength-len(spanIDLabel)-spanIDLength {
+		return errors.Errorf("exemplar trace ID label is too long, got %d characters", l)
+	}
+	return nil
+}
+
+func (g *exemplarGen) Next() bool {
+	if g.err != nil || !g.SeriesIterator.Next() {
+		return false
+	}
+
+	t, v := g.SeriesIterator.At()
+	g.ok = !value.IsStaleNaN(v) && g.random.Float64() < g.opts.Probability
+	if !g.ok {
+		return true
+	}
+
+	lset := labels.Labels{{Name: g.opts.TraceIDLabel, Value: g.hexID(g.opts.TraceIDLength)}}
+	if g.opts.SpanID {
+		lset = append(lset, labels.Label{Name: spanIDLabel, Value: g.hexID(spanIDLength)})
+	}
+	g.e = exemplar.Exemplar{
+		Labels: labels.New(lset...),
+		Value:  g.opts.ValueCorrelation*v + (1-g.opts.ValueCorrelation)*g.sampler.sample(),
+		Ts:     t,
+		HasTs:  true,
+	}
+	return true
+}
+
+func (g *exemplarGen) hexID(length int) string {
+	b := make([]byte, (length+1)/2)
+	_, _ = g.random.Read(b)
+	return hex.EncodeToString(b)[:length]
+}
+
+func (g *exemplarGen) AtExemplar() (exemplar.Exemplar, bool) { return g.e, g.ok }
+
+func (g *exemplarGen) Err() error {
+	if g.err != nil {
+		return g.err
+	}
+	return g.SeriesIterator.Err()
+}
@@ -0,0 +1,60 @@
+package seriesgen
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestWithExemplars(t *testing.T) {
+	opts := Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Min:            100,
+		Max:            200,
+		Exemplars: ExemplarCharacteristics{
+			Probability:      0.5,
+			TraceIDLabel:     "traceID",
+			TraceIDLength:    16,
+			SpanID:           true,
+			ValueCorrelation: 0.5,
+		},
+	}
+	random := rand.New(rand.NewSource(1))
+	iter := WithExemplars(random, NewGaugeGen(random, 0, int64((24*time.Hour).Seconds())*1000, opts), opts)
+
+	eiter, ok := iter.(ExemplarIterator)
+	testutil.Assert(t, ok, "expected exemplar iterator")
+
+	var samples, exemplars int
+	for iter.Next() {
+		samples++
+		e, ok := eiter.AtExemplar()
+		if !ok {
+			continue
+		}
+		exemplars++
+
+		ts, v := iter.At()
+		testutil.Equals(t, ts, e.Ts)
+		testutil.Assert(t, e.HasTs, "")
+		testutil.Equals(t, 16, len(e.Labels.Get("traceID")))
+		testutil.Equals(t, 16, len(e.Labels.Get("span_id")))
+		// Half of the gauge value and half of the random value between 100 and 201.
+		testutil.Assert(t, e.Value >= (v+100)/2 && e.Value < (v+201)/2, "unexpected value %v for sample value %v", e.Value, v)
+	}
+	testutil.Ok(t, iter.Err())
+	testutil.Assert(t, exemplars > samples*4/10 && exemplars < samples*6/10, "unexpected number of exemplars %v of %v", exemplars, samples)
+
+	for _, invalid := range []ExemplarCharacteristics{
+		{Probability: 0.5, TraceIDLength: 200},
+		{Probability: 0.5, TraceIDLength: -1},
+		{Probability: 0.5, TraceIDLabel: "trace-id"},
+	} {
+		opts.Exemplars = invalid
+		iter = WithExemplars(random, NewGaugeGen(random, 0, 1000, opts), opts)
+		testutil.Assert(t, !iter.Next(), "")
+		testutil.NotOk(t, iter.Err())
+	}
+}
@@ -0,0 +1,272 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+var (
+	// DefaultBounds are the classic histogram upper bounds used when HistogramCharacteristics.Bounds is empty.
+	// Same as prometheus.DefBuckets in client_golang.
+	DefaultBounds = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultQuantiles are the summary quantiles used when HistogramCharacteristics.Quantiles is empty.
+	DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+)
+
+// NewClassicHistogramFamily returns all series of a classic histogram: one `<name>_bucket` series per upper bound
+// (including +Inf), `<name>_sum` and `<name>_count`. The `<name>` is taken from the metric name of given labels.
+// Bucket counts are cumulative and monotonic, and `_count` always equals the +Inf bucket.
+//
+// Every series replays the family from the same seed, so series can be iterated independently and concurrently
+// while still agreeing with each other.
+func NewClassicHistogramFamily(seed int64, lset labels.Labels, mint, maxt int64, opts Characteristics) ([]Series, error) {
+	name, bounds, err := familyOpts(lset, opts.Histogram.Bounds)
+	if err != nil {
+		return nil, err
+	}
+	opts.Histogram.Bounds = bounds
+
+	var res []Series
+	for i := 0; i <= len(bounds); i++ {
+		i := i
+		le := math.Inf(+1)
+		if i < len(bounds) {
+			le = bounds[i]
+		}
+		res = append(res, newFamilySeries(seed, familyLabels(lset, name+"_bucket", labels.BucketLabel, le), mint, maxt, opts,
+			func(s *familyState) float64 { return s.cumulative[i] },
+		))
+	}
+	return append(res, familySumAndCount(seed, lset, name, mint, maxt, opts)...), nil
+}
+
+// NewSummaryFamily returns all series of a summary: one `<name>` series per quantile, `<name>_sum` and `<name>_count`.
+// The `<name>` is taken from the metric name of given labels. Quantiles are estimated from observations made since
+// the previous scrape and are NaN if there were none, similar to what client_golang does.
+//
+// Every series replays the family from the same seed, so series can be iterated independently and concurrently
+// while still agreeing with each other.
+func NewSummaryFamily(seed int64, lset labels.Labels, mint, maxt int64, opts Characteristics) ([]Series, error) {
+	name, bounds, err := familyOpts(lset, opts.Histogram.Bounds)
+	if err != nil {
+		return nil, err
+	}
+	opts.Histogram.Bounds = bounds
+
+	quantiles := opts.Histogram.Quantiles
+	if len(quantiles) == 0 {
+		quantiles = DefaultQuantiles
+	}
+
+	var res []Series
+	for _, q := range quantiles {
+		if q < 0 || q > 1 {
+			return nil, errors.Errorf("quantile has to be within [0, 1], got %v", q)
+		}
+		q := q
+		res = append(res, newFamilySeries(seed, familyLabels(lset, name, "quantile", q), mint, maxt, opts,
+			func(s *familyState) float64 { return s.quantile(q) },
+		))
+	}
+	return append(res, familySumAndCount(seed, lset, name, mint, maxt, opts)...), nil
+}
+
+func familyOpts(lset labels.Labels, bounds []float64) (string, []float64, error) {
+	name := lset.Get(labels.MetricName)
+	if name == "" {
+		return "", nil, errors.Errorf("metric family requires %s label, got %s", labels.MetricName, lset.String())
+	}
+	if !sort.Float64sAreSorted(bounds) {
+		return "", nil, errors.Errorf("bounds has to be sorted, got %v", bounds)
+	}
+	if len(bounds) > 0 && math.IsInf(bounds[len(bounds)-1], +1) {
+		// +Inf bucket is always added.
+		bounds = bounds[:len(bounds)-1]
+	}
+	if len(bounds) == 0 {
+		return name, DefaultBounds, nil
+	}
+	return name, bounds, nil
+}
+
+func familyLabels(lset labels.Labels, name string, extraName string, extraValue float64) labels.Labels {
+	b := labels.NewBuilder(lset).Set(labels.MetricName, name)
+	if extraName != "" {
+		b.Set(extraName, strconv.FormatFloat(extraValue, 'g', -1, 64))
+	}
+	return b.Labels(nil)
+}
+
+func familySumAndCount(seed int64, lset labels.Labels, name string, mint, maxt int64, opts Characteristics) []Series {
+	return []Series{
+		newFamilySeries(seed, familyLabels(lset, name+"_sum", "", 0), mint, maxt, opts,
+			func(s *familyState) float64 { return s.sum },
+		),
+		newFamilySeries(seed, familyLabels(lset, name+"_count", "", 0), mint, maxt, opts,
+			func(s *familyState) float64 { return s.cumulative[len(s.cumulative)-1] },
+		),
+	}
+}
+
+type familySeries struct {
+	lset labels.Labels
+
+	seed       int64
+	mint, maxt int64
+	opts       Characteristics
+	value      func(*familyState) float64
+}
+
+func newFamilySeries(seed int64, lset labels.Labels, mint, maxt int64, opts Characteristics, value func(*familyState) float64) *familySeries {
+	return &familySeries{lset: lset, seed: seed, mint: mint, maxt: maxt, opts: opts, value: value}
+}
+
+func (s *familySeries) Labels() labels.Labels { return s.lset }
+
+func (s *familySeries) Iterator() SeriesIterator {
+	return &familyGen{
+		state: newFamilyState(rand.New(rand.NewSource(s.seed)), s.mint, s.maxt, s.opts),
+		value: s.value,
+	}
+}
+
+// familyGen yields a single value of the family state.
+type familyGen struct {
+	state *familyState
+	value func(*familyState) float64
+}
+
+func (g *familyGen) Next() bool { return g.state.next() }
+
+func (g *familyGen) At() (t int64, v float64) { return g.state.minTime, g.value(g.state) }
+
+func (g *familyGen) Err() error { return nil }
+
+// familyState simulates observations of the whole family. Observations are spread over buckets defined by bounds,
+// each bucket getting a fixed, random share of ObservationRate.
+type familyState struct {
+	interval         time.Duration
+	maxTime, minTime int64
+
+	bounds          []float64
+	weights         []float64
+	observationRate float64
+
+	init bool
+
+	// Recent are the observations since the last scrape per bucket, cumulative are counts since start.
+	recent     []float64
+	cumulative []float64
+	sum        float64
+
+	random *rand.Rand
+}
+
+func newFamilyState(random *rand.Rand, mint, maxt int64, opts Characteristics) *familyState {
+	return &familyState{
+		interval:        opts.ScrapeInterval,
+		minTime:         mint,
+		maxTime:         maxt,
+		bounds:          opts.Histogram.Bounds,
+		observationRate: opts.Histogram.ObservationRate,
+		random:          random,
+	}
+}
+
+func (s *familyState) next() bool {
+	if s.minTime > s.maxTime {
+		return false
+	}
+	defer func() { s.minTime += int64(s.interval.Seconds() * 1000) }()
+
+	if !s.init {
+		// Last bucket is +Inf, keep it small.
+		s.weights = make([]float64, len(s.bounds)+1)
+		var wsum float64
+		for i := range s.bounds {
+			s.weights[i] = s.random.Float64() + 0.1
+			wsum += s.weights[i]
+		}
+		s.weights[len(s.bounds)] = 0.01 * wsum
+		wsum += s.weights[len(s.bounds)]
+		for i := range s.weights {
+			s.weights[i] /= wsum
+		}
+		s.recent = make([]float64, len(s.weights))
+		s.cumulative = make([]float64, len(s.weights))
+		s.init = true
+	}
+
+	expected := s.observationRate * s.interval.Seconds()
+	var below float64
+	for i, w := range s.weights {
+		inc := math.Floor(s.random.Float64() * 2 * expected * w)
+		s.recent[i] = inc
+		s.sum += inc * s.bucketMiddle(i)
+
+		below += inc
+		s.cumulative[i] += below
+	}
+	return true
+}
+
+// bucketMiddle returns a representative observed value for i-th bucket.
+func (s *familyState) bucketMiddle(i int) float64 {
+	if i >= len(s.bounds) {
+		return 2 * s.bounds[len(s.bounds)-1]
+	}
+	if i == 0 {
+		return s.bounds[0] / 2
+	}
+	return (s.bounds[i-1] + s.bounds[i]) / 2
+}
+
+// quantile estimates quantile from recent observations using linear interpolation within the bucket.
+func (s *familyState) quantile(q float64) float64 {
+	var total float64
+	for _, r := range s.recent {
+		total += r
+	}
+	if total == 0 {
+		return math.NaN()
+	}
+
+	rank := q * total
+	var below float64
+	for i, r := range s.recent {
+		if below+r < rank || r == 0 {
+			below += r
+			continue
+		}
+		if i >= len(s.bounds) {
+			return s.bucketMiddle(i)
+		}
+		lower := 0.0
+		if i > 0 {
+			lower = s.bounds[i-1]
+		}
+		return lower + (s.bounds[i]-lower)*(rank-below)/r
+	}
+	return s.bucketMiddle(len(s.recent) - 1)
+}
+
+// ClassicHistogramFamilySize returns the number of series NewClassicHistogramFamily creates for given characteristics.
+func ClassicHistogramFamilySize(opts Characteristics) int {
+	_, bounds, _ := familyOpts(labels.FromStrings(labels.MetricName, "size"), opts.Histogram.Bounds)
+	// Buckets, +Inf bucket, sum and count.
+	return len(bounds) + 3
+}
+
+// SummaryFamilySize returns the number of series NewSummaryFamily creates for given characteristics.
+func SummaryFamilySize(opts Characteristics) int {
+	if len(opts.Histogram.Quantiles) == 0 {
+		return len(DefaultQuantiles) + 2
+	}
+	return len(opts.Histogram.Quantiles) + 2
+}
@@ -0,0 +1,97 @@
+package seriesgen
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+func collect(t *testing.T, series []Series) map[string][]sample {
+	t.Helper()
+
+	res := map[string][]sample{}
+	for _, s := range series {
+		iter := s.Iterator()
+		for iter.Next() {
+			ts, v := iter.At()
+			res[s.Labels().String()] = append(res[s.Labels().String()], sample{T: ts, V: v})
+		}
+		testutil.Ok(t, iter.Err())
+	}
+	return res
+}
+
+func TestNewClassicHistogramFamily(t *testing.T) {
+	series, err := NewClassicHistogramFamily(1, labels.FromStrings("__name__", "http_request_duration_seconds", "job", "a"), 0, int64((2*time.Hour).Seconds())*1000, Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Histogram: HistogramCharacteristics{
+			ObservationRate: 20,
+			Bounds:          []float64{0.1, 0.5, 1, math.Inf(+1)},
+		},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 6, len(series))
+
+	var names []string
+	for _, s := range series {
+		names = append(names, s.Labels().String())
+	}
+	testutil.Equals(t, []string{
+		`{__name__="http_request_duration_seconds_bucket", job="a", le="0.1"}`,
+		`{__name__="http_request_duration_seconds_bucket", job="a", le="0.5"}`,
+		`{__name__="http_request_duration_seconds_bucket", job="a", le="1"}`,
+		`{__name__="http_request_duration_seconds_bucket", job="a", le="+Inf"}`,
+		`{__name__="http_request_duration_seconds_sum", job="a"}`,
+		`{__name__="http_request_duration_seconds_count", job="a"}`,
+	}, names)
+
+	res := collect(t, series)
+	count := res[names[5]]
+	testutil.Equals(t, 481, len(count))
+	testutil.Equals(t, res[names[3]], count)
+
+	for i := range count {
+		for b := 0; b < 4; b++ {
+			bucket := res[names[b]]
+			testutil.Equals(t, count[i].T, bucket[i].T)
+			if b > 0 {
+				testutil.Assert(t, res[names[b-1]][i].V <= bucket[i].V, "buckets have to be cumulative")
+			}
+			if i > 0 {
+				testutil.Assert(t, bucket[i-1].V <= bucket[i].V, "buckets have to be monotonic")
+			}
+		}
+	}
+	testutil.Assert(t, count[len(count)-1].V > 0, "")
+	testutil.Assert(t, res[names[4]][len(count)-1].V > 0, "")
+}
+
+func TestNewSummaryFamily(t *testing.T) {
+	series, err := NewSummaryFamily(1, labels.FromStrings("__name__", "rpc_duration_seconds"), 0, int64((2*time.Hour).Seconds())*1000, Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Histogram: HistogramCharacteristics{
+			ObservationRate: 20,
+		},
+	})
+	testutil.Ok(t, err)
+	testutil.Equals(t, 5, len(series))
+
+	res := collect(t, series)
+	q50 := res[`{__name__="rpc_duration_seconds", quantile="0.5"}`]
+	q90 := res[`{__name__="rpc_duration_seconds", quantile="0.9"}`]
+	q99 := res[`{__name__="rpc_duration_seconds", quantile="0.99"}`]
+	count := res[`{__name__="rpc_duration_seconds_count"}`]
+	testutil.Equals(t, 481, len(count))
+	for i := range count {
+		testutil.Assert(t, q50[i].V <= q90[i].V && q90[i].V <= q99[i].V, "quantiles have to be ordered")
+		if i > 0 {
+			testutil.Assert(t, count[i-1].V <= count[i].V, "count has to be monotonic")
+		}
+	}
+
+	_, err = NewSummaryFamily(1, labels.FromStrings("job", "a"), 0, 1000, Characteristics{})
+	testutil.NotOk(t, err)
+}
@@ -0,0 +1,123 @@
+package seriesgen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+// SeriesSeed returns stable random seed for series with given labels, so each series gets different, but reproducible
+// values regardless of the order series are generated in. Non-zero seed gives different values for the same labels.
+func SeriesSeed(seed int64, lsets ...labels.Labels) int64 {
+	b := make([]byte, 0, 1024)
+	for _, lset := range lsets {
+		for _, v := range lset {
+			b = append(b, v.Name...)
+			b = append(b, '\xff')
+			b = append(b, v.Value...)
+			b = append(b, '\xff')
+		}
+	}
+	// Zero seed keeps values generated before seed was configurable.
+	if seed != 0 {
+		var sb [8]byte
+		binary.LittleEndian.PutUint64(sb[:], uint64(seed))
+		b = append(b, sb[:]...)
+	}
+	return int64(xxhash.Sum64(b))
+}
+
+// Fingerprint is a hash of all appended series: their labels, samples and exemplars. It does not depend on the order
+// series are appended in, so datasets generated with the same specification and seed have the same fingerprint.
+type Fingerprint struct {
+	mtx    sync.Mutex
+	sum    uint64
+	series int
+}
+
+func NewFingerprint() *Fingerprint { return &Fingerprint{} }
+
+func (f *Fingerprint) add(h uint64) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.sum += h
+	f.series++
+}
+
+// String returns hex encoded fingerprint.
+func (f *Fingerprint) String() string {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return fmt.Sprintf("%016x", f.sum)
+}
+
+// Series returns the number of series included in fingerprint.
+func (f *Fingerprint) Series() int {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	return f.series
+}
+
+// seriesHash hashes a single series.
+type seriesHash struct {
+	d   *xxhash.Digest
+	buf [8]byte
+}
+
+func newSeriesHash(lset labels.Labels) *seriesHash {
+	h := &seriesHash{d: xxhash.New()}
+	h.labels(lset)
+	return h
+}
+
+func (h *seriesHash) labels(lset labels.Labels) {
+	for _, l := range lset {
+		_, _ = h.d.WriteString(l.Name)
+		_, _ = h.d.WriteString("\xff")
+		_, _ = h.d.WriteString(l.Value)
+		_, _ = h.d.WriteString("\xff")
+	}
+}
+
+func (h *seriesHash) write(vs ...uint64) {
+	for _, v := range vs {
+		binary.LittleEndian.PutUint64(h.buf[:], v)
+		_, _ = h.d.Write(h.buf[:])
+	}
+}
+
+func (h *seriesHash) sample(t int64, v float64) {
+	h.write(uint64(t), math.Float64bits(v))
+}
+
+func (h *seriesHash) histogram(t int64, fh *histogram.Histogram) {
+	h.write(uint64(t), uint64(fh.Schema), math.Float64bits(fh.ZeroThreshold), fh.ZeroCount, fh.Count, math.Float64bits(fh.Sum))
+	for _, spans := range [][]histogram.Span{fh.PositiveSpans, fh.NegativeSpans} {
+		h.write(uint64(len(spans)))
+		for _, s := range spans {
+			h.write(uint64(s.Offset), uint64(s.Length))
+		}
+	}
+	for _, buckets := range [][]int64{fh.PositiveBuckets, fh.NegativeBuckets} {
+		h.write(uint64(len(buckets)))
+		for _, b := range buckets {
+			h.write(uint64(b))
+		}
+	}
+}
+
+func (h *seriesHash) exemplar(e exemplar.Exemplar) {
+	h.labels(e.Labels)
+	h.write(uint64(e.Ts), math.Float64bits(e.Value))
+}
+
+func (h *seriesHash) sum() uint64 { return h.d.Sum64() }
@@ -0,0 +1,86 @@
+package seriesgen
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+)
+
+func fingerprintSet(seed int64) SeriesSet {
+	opts := Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Max:            200,
+		Min:            100,
+		Exemplars:      ExemplarCharacteristics{Probability: 0.1},
+		Histogram:      HistogramCharacteristics{ObservationRate: 10},
+	}
+	maxt := (1 * time.Hour).Milliseconds()
+
+	set := &listSet{}
+	for i := 0; i < 20; i++ {
+		lset := labels.FromStrings("__name__", "gauge", "i", fmt.Sprintf("%v", i))
+		random := rand.New(rand.NewSource(SeriesSeed(seed, lset)))
+		set.series = append(set.series, NewSeriesGen(lset, WithCharacteristics(random, NewGaugeGen(random, 0, maxt, opts), 0, maxt, opts)))
+
+		lset = labels.FromStrings("__name__", "histogram", "i", fmt.Sprintf("%v", i))
+		random = rand.New(rand.NewSource(SeriesSeed(seed, lset)))
+		set.series = append(set.series, NewSeriesGen(lset, NewHistogramGen(random, 0, maxt, opts)))
+	}
+	return set
+}
+
+func TestFingerprint(t *testing.T) {
+	appendFingerprint := func(t *testing.T, goroutines int, set SeriesSet) string {
+		t.Helper()
+
+		f := NewFingerprint()
+		a := &testAppendable{samples: map[uint64][]sample{}, histograms: map[uint64][]*histogram.Histogram{}}
+		testutil.Ok(t, Append(context.Background(), goroutines, a, set, WithFingerprint(f)))
+		testutil.Equals(t, 40, f.Series())
+		return f.String()
+	}
+
+	expected := appendFingerprint(t, 1, fingerprintSet(0))
+	testutil.Equals(t, 16, len(expected))
+
+	// Order of appends does not matter.
+	testutil.Equals(t, expected, appendFingerprint(t, 8, fingerprintSet(0)))
+	// Different seed gives different data.
+	testutil.Assert(t, expected != appendFingerprint(t, 8, fingerprintSet(1)), "expected different fingerprint for different seed")
+}
+
+func TestSeriesSeed(t *testing.T) {
+	a, b := labels.FromStrings("a", "1"), labels.FromStrings("b", "2")
+
+	testutil.Equals(t, SeriesSeed(0, a, b), SeriesSeed(0, a, b))
+	testutil.Assert(t, SeriesSeed(0, a, b) != SeriesSeed(0, b, a))
+	testutil.Assert(t, SeriesSeed(0, a, b) != SeriesSeed(1, a, b))
+	testutil.Assert(t, SeriesSeed(1, a, b) != SeriesSeed(2, a, b))
+}
+
+func TestSeriesHash(t *testing.T) {
+	hash := func(f func(h *seriesHash)) uint64 {
+		h := newSeriesHash(labels.FromStrings("a", "1"))
+		f(h)
+		return h.sum()
+	}
+
+	testutil.Assert(t, hash(func(h *seriesHash) { h.sample(1, 2) }) != hash(func(h *seriesHash) { h.sample(2, 1) }))
+	testutil.Assert(t, hash(func(h *seriesHash) {
+		h.histogram(1, &histogram.Histogram{Count: 1, PositiveSpans: []histogram.Span{{Length: 1}}, PositiveBuckets: []int64{1}})
+	}) != hash(func(h *seriesHash) {
+		h.histogram(1, &histogram.Histogram{Count: 1, NegativeSpans: []histogram.Span{{Length: 1}}, NegativeBuckets: []int64{1}})
+	}))
+	testutil.Assert(t, hash(func(h *seriesHash) {
+		h.exemplar(exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "a"), Ts: 1})
+	}) != hash(func(h *seriesHash) {
+		h.exemplar(exemplar.Exemplar{Labels: labels.FromStrings("trace_id", "b"), Ts: 1})
+	}))
+}
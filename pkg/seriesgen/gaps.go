@@ -0,0 +1,101 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/value"
+)
+
+// GapCharacteristics configures missed scrapes and periods when target is down.
+type GapCharacteristics struct {
+	// MissedScrapeProbability is a probability of each scrape being missed, leaving a gap of one scrape interval.
+	MissedScrapeProbability float64 `yaml:"missedScrapeProbability"`
+
+	// OutageProbability is a probability of target going down on each scrape. When it happens, series gets
+	// staleness marker in place of the failed scrape, the same as Prometheus does, and no samples until the outage ends.
+	OutageProbability float64 `yaml:"outageProbability"`
+	// OutageMinDuration and OutageMaxDuration define range of random outage durations.
+	OutageMinDuration time.Duration `yaml:"outageMinDuration"`
+	OutageMaxDuration time.Duration `yaml:"outageMaxDuration"`
+}
+
+// WithGaps wraps given iterator so it misses scrapes and has outages according to opts.Gaps.
+// Iterator is returned unchanged if no gaps are configured.
+func WithGaps(random *rand.Rand, iter SeriesIterator, opts Characteristics) SeriesIterator {
+	if opts.Gaps == (GapCharacteristics{}) {
+		return iter
+	}
+	g := &gapGen{SeriesIterator: iter, opts: opts.Gaps, random: random}
+	g.err = g.validate()
+	return g
+}
+
+type gapGen struct {
+	SeriesIterator
+
+	opts GapCharacteristics
+
+	// downUntil is the time until which target is down.
+	downUntil int64
+	stale     bool
+	staleT    int64
+	err       error
+
+	random *rand.Rand
+}
+
+func (g *gapGen) validate() error {
+	if g.opts.MissedScrapeProbability < 0 || g.opts.MissedScrapeProbability > 1 {
+		return errors.Errorf("missed scrape probability has to be within [0, 1], got %v", g.opts.MissedScrapeProbability)
+	}
+	if g.opts.OutageProbability < 0 || g.opts.OutageProbability > 1 {
+		return errors.Errorf("outage probability has to be within [0, 1], got %v", g.opts.OutageProbability)
+	}
+	if g.opts.OutageMinDuration < 0 || g.opts.OutageMaxDuration < g.opts.OutageMinDuration {
+		return errors.Errorf("invalid outage duration range [%v, %v]", g.opts.OutageMinDuration, g.opts.OutageMaxDuration)
+	}
+	return nil
+}
+
+func (g *gapGen) Next() bool {
+	if g.err != nil {
+		return false
+	}
+
+	for g.SeriesIterator.Next() {
+		t, _ := g.SeriesIterator.At()
+		if t < g.downUntil {
+			continue
+		}
+
+		if g.opts.OutageProbability > 0 && g.random.Float64() < g.opts.OutageProbability {
+			d := g.opts.OutageMinDuration + time.Duration(g.random.Float64()*float64(g.opts.OutageMaxDuration-g.opts.OutageMinDuration))
+			g.downUntil = t + int64(d.Seconds()*1000)
+			g.stale, g.staleT = true, t
+			return true
+		}
+		if g.opts.MissedScrapeProbability > 0 && g.random.Float64() < g.opts.MissedScrapeProbability {
+			continue
+		}
+		g.stale = false
+		return true
+	}
+	return false
+}
+
+func (g *gapGen) At() (t int64, v float64) {
+	if g.stale {
+		return g.staleT, math.Float64frombits(value.StaleNaN)
+	}
+	return g.SeriesIterator.At()
+}
+
+func (g *gapGen) Err() error {
+	if g.err != nil {
+		return g.err
+	}
+	return g.SeriesIterator.Err()
+}
@@ -0,0 +1,65 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/value"
+)
+
+func TestWithGaps(t *testing.T) {
+	opts := Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Min:            100,
+		Max:            200,
+	}
+	g := NewGaugeGen(rand.New(rand.NewSource(1)), 0, int64((24*time.Hour).Seconds())*1000, opts)
+	testutil.Equals(t, SeriesIterator(g), WithGaps(rand.New(rand.NewSource(1)), g, opts))
+
+	opts.Gaps = GapCharacteristics{
+		MissedScrapeProbability: 0.01,
+		OutageProbability:       0.001,
+		OutageMinDuration:       10 * time.Minute,
+		OutageMaxDuration:       30 * time.Minute,
+	}
+	random := rand.New(rand.NewSource(1))
+	iter := WithGaps(random, NewGaugeGen(random, 0, int64((24*time.Hour).Seconds())*1000, opts), opts)
+
+	var (
+		samples, missed, outages int
+		lastT                    int64
+		lastStale                bool
+	)
+	for iter.Next() {
+		samples++
+		ts, v := iter.At()
+		if samples > 1 {
+			switch gap := ts - lastT; {
+			case lastStale:
+				testutil.Assert(t, gap >= (10*time.Minute).Milliseconds(), "outage too short: %v", gap)
+			case gap > (15 * time.Second).Milliseconds():
+				missed++
+			}
+		}
+
+		lastStale = value.IsStaleNaN(v)
+		if lastStale {
+			outages++
+		} else {
+			testutil.Assert(t, !math.IsNaN(v), "")
+		}
+		lastT = ts
+	}
+	testutil.Ok(t, iter.Err())
+	testutil.Assert(t, outages > 0, "expected outages")
+	testutil.Assert(t, missed > 0, "expected missed scrapes")
+	testutil.Assert(t, samples < int((24*time.Hour)/(15*time.Second)), "")
+
+	opts.Gaps.OutageMaxDuration = time.Minute
+	iter = WithGaps(random, NewGaugeGen(random, 0, 1000, opts), opts)
+	testutil.Assert(t, !iter.Next(), "")
+	testutil.NotOk(t, iter.Err())
+}
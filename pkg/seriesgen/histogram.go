@@ -0,0 +1,199 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/histogram"
+)
+
+const (
+	// defaultHistogramBuckets is used when HistogramCharacteristics.Buckets is not specified.
+	defaultHistogramBuckets = 10
+	// defaultZeroThreshold is the same default as used by client_golang.
+	defaultZeroThreshold = 2.938735877055719e-39 // 2^-128
+)
+
+// HistogramIterator iterates over native histogram samples of a time series.
+// Iterators implementing it are appended as native histograms.
+type HistogramIterator interface {
+	SeriesIterator
+
+	// AtHistogram returns the current timestamp/histogram pair.
+	// Returned histogram must not be modified, and it is not modified by the iterator after Next.
+	AtHistogram() (t int64, h *histogram.Histogram)
+}
+
+// HistogramCharacteristics configures native histograms, classic histograms and summaries.
+type HistogramCharacteristics struct {
+	// Schema is the native histogram resolution from -4 (coarsest) to 8 (finest).
+	Schema int32 `yaml:"schema"`
+	// Buckets is the number of populated native histogram buckets. If 0, 10 is used.
+	Buckets int `yaml:"buckets"`
+	// Sparsity is a ratio [0, 1) of empty native histogram buckets within the observed range.
+	Sparsity float64 `yaml:"sparsity"`
+	// ObservationRate is the average number of observations per second.
+	ObservationRate float64 `yaml:"observationRate"`
+
+	// Bounds are sorted upper bounds of classic histogram buckets, also used to model summary observations.
+	// If empty, DefaultBounds are used.
+	Bounds []float64 `yaml:"bounds"`
+	// Quantiles are summary quantiles. If empty, DefaultQuantiles are used.
+	Quantiles []float64 `yaml:"quantiles"`
+}
+
+var _ HistogramIterator = &HistogramGen{}
+
+// HistogramGen generates cumulative native histogram samples with observations spread over
+// a fixed set of buckets, starting at the bucket containing Characteristics.Min.
+type HistogramGen struct {
+	interval         time.Duration
+	maxTime, minTime int64
+
+	opts HistogramCharacteristics
+	min  float64
+
+	init bool
+	err  error
+
+	// Indexes of populated buckets (ascending), their positions in counts and their share of observations.
+	indexes   []int32
+	positions []int
+	weights   []float64
+	last      int32
+
+	spans  []histogram.Span
+	counts []uint64
+	count  uint64
+	sum    float64
+
+	curr *histogram.Histogram
+
+	random *rand.Rand
+}
+
+func NewHistogramGen(random *rand.Rand, mint, maxt int64, opts Characteristics) *HistogramGen {
+	return &HistogramGen{
+		interval: opts.ScrapeInterval,
+		min:      opts.Min,
+		minTime:  mint,
+		maxTime:  maxt,
+		opts:     opts.Histogram,
+		random:   random,
+	}
+}
+
+func (g *HistogramGen) initBuckets() error {
+	if g.opts.Schema < -4 || g.opts.Schema > 8 {
+		return errors.Errorf("histogram schema has to be within [-4, 8], got %d", g.opts.Schema)
+	}
+	if g.opts.Sparsity < 0 || g.opts.Sparsity >= 1 {
+		return errors.Errorf("histogram sparsity has to be within [0, 1), got %v", g.opts.Sparsity)
+	}
+	buckets := g.opts.Buckets
+	if buckets <= 0 {
+		buckets = defaultHistogramBuckets
+	}
+
+	var first int32
+	if g.min > 0 {
+		first = int32(math.Ceil(math.Log2(g.min) * math.Exp2(float64(g.opts.Schema))))
+	}
+
+	// Choose populated positions within observed range. The first and last are always populated.
+	width := 1
+	if buckets > 1 {
+		width = int(math.Ceil(float64(buckets) / (1 - g.opts.Sparsity)))
+	}
+	populated := make([]bool, width)
+	populated[0], populated[width-1] = true, true
+	if buckets > 2 {
+		for _, p := range g.random.Perm(width - 2)[:buckets-2] {
+			populated[p+1] = true
+		}
+	}
+
+	// Split spans on gaps bigger than 2, the same as client_golang does. Smaller gaps are encoded as empty buckets.
+	var wsum float64
+	for i, ok := range populated {
+		if !ok {
+			continue
+		}
+		idx := first + int32(i)
+		switch {
+		case len(g.spans) == 0:
+			g.spans = append(g.spans, histogram.Span{Offset: idx, Length: 1})
+			g.counts = append(g.counts, 0)
+		case idx-g.last-1 > 2:
+			g.spans = append(g.spans, histogram.Span{Offset: idx - g.last - 1, Length: 1})
+			g.counts = append(g.counts, 0)
+		default:
+			gap := idx - g.last - 1
+			g.spans[len(g.spans)-1].Length += uint32(gap) + 1
+			g.counts = append(g.counts, make([]uint64, gap+1)...)
+		}
+		g.last = idx
+
+		w := g.random.Float64() + 0.1
+		g.indexes = append(g.indexes, idx)
+		g.positions = append(g.positions, len(g.counts)-1)
+		g.weights = append(g.weights, w)
+		wsum += w
+	}
+	for i := range g.weights {
+		g.weights[i] /= wsum
+	}
+	return nil
+}
+
+func (g *HistogramGen) Next() bool {
+	if g.err != nil || g.minTime > g.maxTime {
+		return false
+	}
+	defer func() { g.minTime += int64(g.interval.Seconds() * 1000) }()
+
+	if !g.init {
+		if err := g.initBuckets(); err != nil {
+			g.err = err
+			return false
+		}
+		g.init = true
+	}
+
+	expected := g.opts.ObservationRate * g.interval.Seconds()
+	for i, idx := range g.indexes {
+		inc := uint64(g.random.Float64() * 2 * expected * g.weights[i])
+		g.counts[g.positions[i]] += inc
+		g.count += inc
+		// Use geometric middle of the bucket as observed value.
+		g.sum += float64(inc) * math.Exp2((float64(idx)-0.5)*math.Exp2(-float64(g.opts.Schema)))
+	}
+
+	h := &histogram.Histogram{
+		Schema:          g.opts.Schema,
+		ZeroThreshold:   defaultZeroThreshold,
+		Count:           g.count,
+		Sum:             g.sum,
+		PositiveSpans:   make([]histogram.Span, len(g.spans)),
+		PositiveBuckets: make([]int64, len(g.counts)),
+	}
+	copy(h.PositiveSpans, g.spans)
+
+	// Buckets are delta encoded.
+	var last int64
+	for i, v := range g.counts {
+		h.PositiveBuckets[i] = int64(v) - last
+		last = int64(v)
+	}
+	g.curr = h
+	return true
+}
+
+// At returns the current timestamp and the total count of observations.
+func (g *HistogramGen) At() (t int64, v float64) { return g.minTime, float64(g.curr.Count) }
+
+func (g *HistogramGen) AtHistogram() (t int64, h *histogram.Histogram) { return g.minTime, g.curr }
+
+func (g *HistogramGen) Err() error { return g.err }
@@ -0,0 +1,275 @@
+package seriesgen
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// ValueShape is a shape of generated label values.
+type ValueShape string
+
+const (
+	// SequentialShape values are prefix and value number, e.g. "pod-3". This is the default.
+	SequentialShape ValueShape = "SEQUENTIAL"
+	// RandomShape values are random strings of characters from the charset.
+	RandomShape ValueShape = "RANDOM"
+	// UUIDShape values are random version 4 UUIDs.
+	UUIDShape ValueShape = "UUID"
+	// IPShape values are IPv4 addresses.
+	IPShape ValueShape = "IP"
+	// PathShape values are URL-like paths, e.g. "/aX3/bb9/Qz", of characters from the charset.
+	PathShape ValueShape = "PATH"
+)
+
+// Charset is a set of characters of RANDOM and PATH values.
+type Charset string
+
+const (
+	// AlphanumericCharset are ASCII letters and digits. This is the default.
+	AlphanumericCharset Charset = "ALPHANUMERIC"
+	// HexCharset are lower case hexadecimal digits.
+	HexCharset Charset = "HEX"
+	// UnicodeCharset are multi-byte characters from various scripts, including CJK and emoji.
+	UnicodeCharset Charset = "UNICODE"
+)
+
+var (
+	alphanumericAlphabet = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+	hexAlphabet          = []rune("0123456789abcdef")
+	unicodeAlphabet      = func() []rune {
+		var res []rune
+		for _, r := range [][2]rune{
+			{'a', 'z'},
+			{0xE0, 0xFF},       // Latin-1 Supplement.
+			{0x3B1, 0x3C9},     // Greek.
+			{0x430, 0x44F},     // Cyrillic.
+			{0x5D0, 0x5EA},     // Hebrew.
+			{0x4E00, 0x4E7F},   // CJK Unified Ideographs.
+			{0x1F600, 0x1F64F}, // Emoticons.
+		} {
+			for c := r[0]; c <= r[1]; c++ {
+				if c == 0xF7 { // Division sign.
+					continue
+				}
+				res = append(res, c)
+			}
+		}
+		return res
+	}()
+)
+
+// uuidNodeDigits is the number of hexadecimal digits of the last part of UUID.
+const uuidNodeDigits = 12
+
+// defaultValueLength is the length of RANDOM and PATH values, if not specified.
+const defaultValueLength = 16
+
+// LengthCharacteristics describes length of label values in characters.
+type LengthCharacteristics struct {
+	Min int `yaml:"min"`
+	Max int `yaml:"max"`
+	// Distribution of lengths between Min and Max, e.g. UNIFORM (default), NORMAL or ZIPF.
+	Distribution Distribution `yaml:"distribution"`
+}
+
+func (l LengthCharacteristics) withDefaults() LengthCharacteristics {
+	if l.Min == 0 && l.Max == 0 {
+		l.Min, l.Max = defaultValueLength, defaultValueLength
+	}
+	if l.Max < l.Min {
+		l.Max = l.Min
+	}
+	return l
+}
+
+// labelValues generates values of a single label from the value number. Values are deterministic for the given
+// seed, so the same value number always gives the same value, regardless of the order they are generated in.
+type labelValues struct {
+	model LabelModel
+	seed  int64
+
+	alphabet []rune
+	length   *valueSampler
+	// common is the value which prefix is shared by all values.
+	common []rune
+	// digits is the number of characters at the end of RANDOM, PATH and UUID values encoding the value number,
+	// which makes them unique.
+	digits int
+
+	ipBase, ipMult, ipOffset uint64
+	hostBits                 int
+
+	random *rand.Rand
+}
+
+func newLabelValues(seed int64, l LabelModel) (*labelValues, error) {
+	v := &labelValues{model: l, seed: seed, random: rand.New(&splitMix64{})}
+	if l.Prefix == "" && (l.Shape == "" || l.Shape == SequentialShape) {
+		v.model.Prefix = l.Name + "-"
+	}
+	if l.CommonPrefixRatio < 0 || l.CommonPrefixRatio >= 1 {
+		return nil, errors.Errorf("common prefix ratio of label %s has to be in [0, 1), got %v", l.Name, l.CommonPrefixRatio)
+	}
+
+	switch l.Charset {
+	case "", AlphanumericCharset:
+		v.alphabet = alphanumericAlphabet
+	case HexCharset:
+		v.alphabet = hexAlphabet
+	case UnicodeCharset:
+		v.alphabet = unicodeAlphabet
+	default:
+		return nil, errors.Errorf("unsupported charset of label %s: %s", l.Name, string(l.Charset))
+	}
+
+	switch l.Shape {
+	case "", SequentialShape:
+	case RandomShape, PathShape:
+		length := l.Length.withDefaults()
+		v.model.Length = length
+		v.digits = numDigits(l.Values-1, len(v.alphabet))
+		minLength := v.digits
+		if l.Shape == PathShape {
+			// Leading slash.
+			minLength++
+		}
+		if length.Min < minLength {
+			return nil, errors.Errorf("%d values of label %s require length at least %d, got %d", l.Values, l.Name, minLength, length.Min)
+		}
+
+		opts := Characteristics{Distribution: length.Distribution, Min: float64(length.Min), Max: float64(length.Max), Integer: true}
+		if length.Min == length.Max {
+			opts.Distribution = ConstantDistribution
+		}
+		var err error
+		if v.length, err = newValueSampler(v.random, opts); err != nil {
+			return nil, errors.Wrapf(err, "length of label %s", l.Name)
+		}
+		v.reseed(-1)
+		v.common = v.runes(length.Max, nil, 0)
+	case UUIDShape:
+		// Value number is encoded in the last, node part of UUID.
+		v.digits = numDigits(l.Values-1, len(hexAlphabet))
+		if v.digits > uuidNodeDigits {
+			return nil, errors.Errorf("label %s has at most %d UUID values, got %d", l.Name, uint64(1)<<(4*uuidNodeDigits), l.Values)
+		}
+		v.reseed(-1)
+		v.common = []rune(v.uuid())
+	case IPShape:
+		v.hostBits = 32 - int(l.CommonPrefixRatio*32)
+		if uint64(l.Values) > 1<<v.hostBits {
+			return nil, errors.Errorf("label %s with common prefix ratio %v has at most %d IP values, got %d", l.Name, l.CommonPrefixRatio, uint64(1)<<v.hostBits, l.Values)
+		}
+		v.reseed(-1)
+		v.ipBase = uint64(v.random.Uint32())
+		// Odd multiplier makes value numbers a permutation of host addresses.
+		v.ipMult = v.random.Uint64() | 1
+		v.ipOffset = v.random.Uint64()
+	default:
+		return nil, errors.Errorf("unsupported shape of label %s: %s", l.Name, string(l.Shape))
+	}
+	return v, nil
+}
+
+func (v *labelValues) reseed(idx int) {
+	v.random.Seed(v.seed ^ int64(uint64(idx+1)*0xbf58476d1ce4e5b9))
+}
+
+// get returns value with given number.
+func (v *labelValues) get(idx int) string {
+	switch v.model.Shape {
+	case RandomShape, PathShape:
+		v.reseed(idx)
+		length := int(v.length.sample())
+		if length < v.model.Length.Min {
+			length = v.model.Length.Min
+		}
+		if length > v.model.Length.Max {
+			length = v.model.Length.Max
+		}
+
+		common := int(v.model.CommonPrefixRatio * float64(length))
+		if common > length-v.digits {
+			common = length - v.digits
+		}
+		r := v.runes(length, v.common, common)
+		// Encode the value number at the end, so values are unique.
+		for i, n := len(r)-1, idx; i >= len(r)-v.digits; i, n = i-1, n/len(v.alphabet) {
+			r[i] = v.alphabet[n%len(v.alphabet)]
+		}
+		return v.model.Prefix + string(r)
+	case UUIDShape:
+		v.reseed(idx)
+		u := []rune(v.uuid())
+		common := int(v.model.CommonPrefixRatio * float64(len(u)))
+		if common > len(u)-v.digits {
+			common = len(u) - v.digits
+		}
+		copy(u, v.common[:common])
+		for i, n := len(u)-1, idx; i >= len(u)-v.digits; i, n = i-1, n/len(hexAlphabet) {
+			u[i] = hexAlphabet[n%len(hexAlphabet)]
+		}
+		return v.model.Prefix + string(u)
+	case IPShape:
+		hostMask := uint64(1)<<v.hostBits - 1
+		ip := v.ipBase&^hostMask | (uint64(idx)*v.ipMult+v.ipOffset)&hostMask
+		return fmt.Sprintf("%s%d.%d.%d.%d", v.model.Prefix, byte(ip>>24), byte(ip>>16), byte(ip>>8), byte(ip))
+	default:
+		return v.model.Prefix + strconv.Itoa(idx)
+	}
+}
+
+// runes returns random characters of given length, with the first n characters copied from the common ones.
+func (v *labelValues) runes(length int, common []rune, n int) []rune {
+	r := make([]rune, length)
+	for i := range r {
+		switch {
+		case i < n:
+			r[i] = common[i]
+		case v.model.Shape == PathShape && (i == 0 || (r[i-1] != '/' && i < length-v.digits-1 && v.random.Intn(6) == 0)):
+			r[i] = '/'
+		default:
+			r[i] = v.alphabet[v.random.Intn(len(v.alphabet))]
+		}
+	}
+	return r
+}
+
+// numDigits returns the number of digits of n in given base.
+func numDigits(n, base int) int {
+	d := 1
+	for ; n >= base; n /= base {
+		d++
+	}
+	return d
+}
+
+func (v *labelValues) uuid() string {
+	var b [16]byte
+	for i := range b {
+		b[i] = byte(v.random.Intn(256))
+	}
+	b[6] = b[6]&0x0f | 0x40 // Version 4.
+	b[8] = b[8]&0x3f | 0x80 // Variant RFC 4122.
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// splitMix64 is a rand.Source which is cheap to seed, so each label value can be generated from its own seed.
+type splitMix64 struct {
+	state uint64
+}
+
+func (s *splitMix64) Seed(seed int64) { s.state = uint64(seed) }
+
+func (s *splitMix64) Int63() int64 { return int64(s.Uint64() >> 1) }
+
+func (s *splitMix64) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
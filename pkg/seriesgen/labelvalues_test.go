@@ -0,0 +1,149 @@
+package seriesgen
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestLabelValues(t *testing.T) {
+	for _, tcase := range []struct {
+		name   string
+		model  LabelModel
+		regexp string
+		check  func(t *testing.T, values []string)
+	}{
+		{
+			name:   "sequential",
+			model:  LabelModel{Name: "pod", Values: 100},
+			regexp: `^pod-\d+$`,
+		},
+		{
+			name:   "random with length distribution",
+			model:  LabelModel{Name: "a", Values: 1000, Shape: RandomShape, Length: LengthCharacteristics{Min: 5, Max: 40, Distribution: NormalDistribution}},
+			regexp: `^[a-zA-Z0-9]{5,40}$`,
+			check: func(t *testing.T, values []string) {
+				lengths := map[int]struct{}{}
+				for _, v := range values {
+					lengths[len(v)] = struct{}{}
+				}
+				testutil.Assert(t, len(lengths) > 10, "expected various lengths, got %v", lengths)
+			},
+		},
+		{
+			name:   "random with common prefix",
+			model:  LabelModel{Name: "a", Values: 1000, Shape: RandomShape, Charset: HexCharset, Length: LengthCharacteristics{Min: 20, Max: 20}, CommonPrefixRatio: 0.5},
+			regexp: `^[0-9a-f]{20}$`,
+			check: func(t *testing.T, values []string) {
+				for _, v := range values {
+					testutil.Equals(t, values[0][:10], v[:10])
+				}
+			},
+		},
+		{
+			name:   "uuid",
+			model:  LabelModel{Name: "id", Values: 1000, Shape: UUIDShape},
+			regexp: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+		},
+		{
+			name:   "uuid with high common prefix",
+			model:  LabelModel{Name: "id", Values: 5000, Shape: UUIDShape, CommonPrefixRatio: 0.95},
+			regexp: `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+			check: func(t *testing.T, values []string) {
+				// 4 trailing digits are left for value numbers.
+				for _, v := range values {
+					testutil.Equals(t, values[0][:32], v[:32])
+				}
+			},
+		},
+		{
+			name:   "ip within subnet",
+			model:  LabelModel{Name: "instance", Values: 256, Shape: IPShape, CommonPrefixRatio: 0.75},
+			regexp: `^\d+\.\d+\.\d+\.\d+$`,
+			check: func(t *testing.T, values []string) {
+				_, subnet, err := net.ParseCIDR(values[0] + "/24")
+				testutil.Ok(t, err)
+				for _, v := range values {
+					testutil.Assert(t, net.ParseIP(v) != nil, "invalid IP %v", v)
+					testutil.Assert(t, subnet.Contains(net.ParseIP(v)), "IP %v not in %v", v, subnet)
+				}
+			},
+		},
+		{
+			name:   "path",
+			model:  LabelModel{Name: "path", Values: 1000, Shape: PathShape, Prefix: "/api", Length: LengthCharacteristics{Min: 10, Max: 30}},
+			regexp: `^/api(/[a-zA-Z0-9]+)+$`,
+		},
+		{
+			name:  "unicode",
+			model: LabelModel{Name: "a", Values: 1000, Shape: RandomShape, Charset: UnicodeCharset},
+			check: func(t *testing.T, values []string) {
+				for _, v := range values {
+					testutil.Assert(t, utf8.ValidString(v), "invalid UTF-8 %q", v)
+					testutil.Equals(t, 16, utf8.RuneCountInString(v))
+				}
+				testutil.Assert(t, len(strings.Join(values, "")) > 2*16*len(values), "expected mostly multi-byte characters")
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			v, err := newLabelValues(1, tcase.model)
+			testutil.Ok(t, err)
+
+			var re *regexp.Regexp
+			if tcase.regexp != "" {
+				re = regexp.MustCompile(tcase.regexp)
+			}
+			values := make([]string, tcase.model.Values)
+			unique := map[string]struct{}{}
+			for i := range values {
+				values[i] = v.get(i)
+				unique[values[i]] = struct{}{}
+				testutil.Assert(t, re == nil || re.MatchString(values[i]), "value %q does not match %v", values[i], re)
+			}
+			testutil.Equals(t, len(values), len(unique))
+			if tcase.check != nil {
+				tcase.check(t, values)
+			}
+
+			// Values do not depend on the order they are generated in.
+			for i := len(values) - 1; i >= 0; i-- {
+				testutil.Equals(t, values[i], v.get(i))
+			}
+		})
+	}
+}
+
+func TestLabelValues_Invalid(t *testing.T) {
+	for _, tcase := range []struct {
+		model LabelModel
+		err   string
+	}{
+		{
+			model: LabelModel{Name: "a", Values: 100, Shape: "WORDS"},
+			err:   "unsupported shape of label a: WORDS",
+		},
+		{
+			model: LabelModel{Name: "a", Values: 100, Shape: RandomShape, Charset: HexCharset, Length: LengthCharacteristics{Min: 1, Max: 5}},
+			err:   "100 values of label a require length at least 2, got 1",
+		},
+		{
+			model: LabelModel{Name: "a", Values: 300, Shape: IPShape, CommonPrefixRatio: 0.75},
+			err:   "label a with common prefix ratio 0.75 has at most 256 IP values, got 300",
+		},
+		{
+			model: LabelModel{Name: "a", Values: 10, Shape: UUIDShape, CommonPrefixRatio: 1},
+			err:   "common prefix ratio of label a has to be in [0, 1), got 1",
+		},
+	} {
+		t.Run(tcase.err, func(t *testing.T) {
+			_, err := newLabelValues(1, tcase.model)
+			testutil.NotOk(t, err)
+			testutil.Equals(t, tcase.err, err.Error())
+		})
+	}
+}
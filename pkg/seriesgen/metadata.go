@@ -0,0 +1,60 @@
+package seriesgen
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+// MetadataSeries is a series with metric metadata. Metadata of series implementing it is appended together with samples.
+type MetadataSeries interface {
+	Series
+
+	// Metadata returns TYPE, HELP and UNIT of the metric family the series belongs to.
+	Metadata() metadata.Metadata
+}
+
+// knownUnits are base units recognized in metric name suffixes, as recommended by Prometheus naming conventions.
+var knownUnits = []string{"seconds", "bytes", "ratio", "celsius", "meters", "grams", "joules", "volts", "amperes", "percent"}
+
+// NewMetadata returns metadata of the metric family with given type and metric name from given labels.
+// If help is empty, a generic description is used. If unit is empty, it is derived from the metric name suffix,
+// e.g. "seconds" for "http_request_duration_seconds" or "bytes" for "network_received_bytes_total".
+func NewMetadata(typ textparse.MetricType, lset labels.Labels, help, unit string) metadata.Metadata {
+	name := lset.Get(labels.MetricName)
+	if help == "" {
+		help = fmt.Sprintf("Generated %s %s.", typ, name)
+	}
+	if unit == "" {
+		unit = unitFromName(typ, name)
+	}
+	return metadata.Metadata{Type: typ, Help: help, Unit: unit}
+}
+
+func unitFromName(typ textparse.MetricType, name string) string {
+	if typ == textparse.MetricTypeCounter {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	for _, u := range knownUnits {
+		if strings.HasSuffix(name, "_"+u) {
+			return u
+		}
+	}
+	return ""
+}
+
+// WithMetadata returns series with given metadata. Iterator of the series is unchanged.
+func WithMetadata(s Series, m metadata.Metadata) Series {
+	return &metadataSeries{Series: s, m: m}
+}
+
+type metadataSeries struct {
+	Series
+
+	m metadata.Metadata
+}
+
+func (s *metadataSeries) Metadata() metadata.Metadata { return s.m }
@@ -0,0 +1,46 @@
+package seriesgen
+
+import (
+	"testing"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/metadata"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+func TestNewMetadata(t *testing.T) {
+	for _, tcase := range []struct {
+		typ        textparse.MetricType
+		name       string
+		help, unit string
+
+		expected metadata.Metadata
+	}{
+		{
+			typ: textparse.MetricTypeGauge, name: "up",
+			expected: metadata.Metadata{Type: textparse.MetricTypeGauge, Help: "Generated gauge up."},
+		},
+		{
+			typ: textparse.MetricTypeCounter, name: "node_network_receive_bytes_total",
+			expected: metadata.Metadata{Type: textparse.MetricTypeCounter, Help: "Generated counter node_network_receive_bytes_total.", Unit: "bytes"},
+		},
+		{
+			typ: textparse.MetricTypeHistogram, name: "http_request_duration_seconds", help: "Latency of HTTP requests.",
+			expected: metadata.Metadata{Type: textparse.MetricTypeHistogram, Help: "Latency of HTTP requests.", Unit: "seconds"},
+		},
+		{
+			typ: textparse.MetricTypeGauge, name: "process_resident_memory_bytes", unit: "megabytes",
+			expected: metadata.Metadata{Type: textparse.MetricTypeGauge, Help: "Generated gauge process_resident_memory_bytes.", Unit: "megabytes"},
+		},
+		{
+			// Only counters have _total suffix stripped.
+			typ: textparse.MetricTypeGauge, name: "cpu_seconds_total",
+			expected: metadata.Metadata{Type: textparse.MetricTypeGauge, Help: "Generated gauge cpu_seconds_total."},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			testutil.Equals(t, tcase.expected, NewMetadata(tcase.typ, labels.FromStrings("__name__", tcase.name), tcase.help, tcase.unit))
+		})
+	}
+}
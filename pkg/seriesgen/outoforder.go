@@ -0,0 +1,108 @@
+package seriesgen
+
+import (
+	"container/heap"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OutOfOrderCharacteristics configures out-of-order samples, e.g. as pushed by delayed remote write clients.
+type OutOfOrderCharacteristics struct {
+	// Probability of delaying each sample, so it is yielded after newer samples.
+	Probability float64 `yaml:"probability"`
+	// Window is the maximum delay of a sample. The delayed sample is never older than Window compared to
+	// the newest sample yielded before it, so it matches TSDB out-of-order time window of the same size.
+	Window time.Duration `yaml:"window"`
+}
+
+// WithOutOfOrder wraps given iterator so its samples are reordered within opts.OutOfOrder.Window.
+// Iterator is returned unchanged if no out-of-order samples are configured.
+func WithOutOfOrder(random *rand.Rand, iter SeriesIterator, opts Characteristics) SeriesIterator {
+	if opts.OutOfOrder.Probability == 0 {
+		return iter
+	}
+
+	g := &outOfOrderGen{SeriesIterator: iter, opts: opts.OutOfOrder, random: random}
+	if g.opts.Probability < 0 || g.opts.Probability > 1 {
+		g.err = errors.Errorf("out-of-order probability has to be within [0, 1], got %v", g.opts.Probability)
+	}
+	if g.opts.Window.Milliseconds() <= 0 {
+		g.err = errors.Errorf("out-of-order window has to be at least 1ms, got %v", g.opts.Window)
+	}
+	return g
+}
+
+type outOfOrderGen struct {
+	SeriesIterator
+
+	opts OutOfOrderCharacteristics
+
+	// next is the next in-order sample of the underlying iterator, if ok.
+	next    delayedSample
+	nextOk  bool
+	delayed delayedSamples
+
+	t   int64
+	v   float64
+	err error
+
+	random *rand.Rand
+}
+
+type delayedSample struct {
+	// until is a timestamp of the newest sample yielded before this one.
+	until int64
+	t     int64
+	v     float64
+}
+
+func (g *outOfOrderGen) Next() bool {
+	if g.err != nil {
+		return false
+	}
+
+	for !g.nextOk && g.SeriesIterator.Next() {
+		t, v := g.SeriesIterator.At()
+		if g.random.Float64() >= g.opts.Probability {
+			g.next, g.nextOk = delayedSample{t: t, v: v}, true
+			break
+		}
+		heap.Push(&g.delayed, delayedSample{until: t + 1 + g.random.Int63n(g.opts.Window.Milliseconds()), t: t, v: v})
+	}
+
+	if len(g.delayed) > 0 && (!g.nextOk || g.delayed[0].until < g.next.t) {
+		s := heap.Pop(&g.delayed).(delayedSample)
+		g.t, g.v = s.t, s.v
+		return true
+	}
+	if !g.nextOk {
+		return false
+	}
+	g.t, g.v, g.nextOk = g.next.t, g.next.v, false
+	return true
+}
+
+func (g *outOfOrderGen) At() (t int64, v float64) { return g.t, g.v }
+
+func (g *outOfOrderGen) Err() error {
+	if g.err != nil {
+		return g.err
+	}
+	return g.SeriesIterator.Err()
+}
+
+// delayedSamples is a min-heap of delayed samples ordered by their delay.
+type delayedSamples []delayedSample
+
+func (h delayedSamples) Len() int           { return len(h) }
+func (h delayedSamples) Less(i, j int) bool { return h[i].until < h[j].until }
+func (h delayedSamples) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *delayedSamples) Push(x any)        { *h = append(*h, x.(delayedSample)) }
+func (h *delayedSamples) Pop() any {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
@@ -0,0 +1,61 @@
+package seriesgen
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestWithOutOfOrder(t *testing.T) {
+	opts := Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Min:            100,
+		Max:            200,
+	}
+	g := NewGaugeGen(rand.New(rand.NewSource(1)), 0, int64((24*time.Hour).Seconds())*1000, opts)
+	testutil.Equals(t, SeriesIterator(g), WithOutOfOrder(rand.New(rand.NewSource(1)), g, opts))
+
+	expected := collectIter(t, NewGaugeGen(rand.New(rand.NewSource(1)), 0, int64((24*time.Hour).Seconds())*1000, opts))
+
+	opts.OutOfOrder = OutOfOrderCharacteristics{Probability: 0.1, Window: 5 * time.Minute}
+	random := rand.New(rand.NewSource(1))
+	got := collectIter(t, WithOutOfOrder(random, g, opts))
+
+	var (
+		maxT int64 = -1
+		ooo  int
+	)
+	for _, s := range got {
+		if s.T < maxT {
+			ooo++
+			testutil.Assert(t, maxT-s.T <= (5*time.Minute).Milliseconds(), "sample %v is older than window, newest %v", s.T, maxT)
+		}
+		if s.T > maxT {
+			maxT = s.T
+		}
+	}
+	testutil.Assert(t, ooo > len(got)/20 && ooo < len(got)/5, "unexpected number of out-of-order samples %v of %v", ooo, len(got))
+
+	// Reordering does not change samples.
+	sort.Slice(got, func(i, j int) bool { return got[i].T < got[j].T })
+	testutil.Equals(t, expected, got)
+
+	opts.OutOfOrder.Window = 0
+	iter := WithOutOfOrder(random, NewGaugeGen(random, 0, 1000, opts), opts)
+	testutil.Assert(t, !iter.Next(), "")
+	testutil.NotOk(t, iter.Err())
+}
+
+func collectIter(t *testing.T, iter SeriesIterator) (res []sample) {
+	t.Helper()
+
+	for iter.Next() {
+		ts, v := iter.At()
+		res = append(res, sample{T: ts, V: v})
+	}
+	testutil.Ok(t, iter.Err())
+	return res
+}
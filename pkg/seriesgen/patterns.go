@@ -0,0 +1,82 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// PatternCharacteristics configures value patterns on top of a gauge.
+type PatternCharacteristics struct {
+	// DailyAmplitude is an amplitude of daily sinusoidal seasonality peaking at 12:00 UTC.
+	DailyAmplitude float64 `yaml:"dailyAmplitude"`
+	// WeeklyAmplitude is an amplitude of weekly sinusoidal seasonality peaking on Thursday 00:00 UTC.
+	WeeklyAmplitude float64 `yaml:"weeklyAmplitude"`
+	// Trend is a linear change of value per hour since series start.
+	Trend float64 `yaml:"trend"`
+
+	// Steps are permanent value changes, e.g. after deployments.
+	Steps []Event `yaml:"steps"`
+	// Spikes are temporary value changes, e.g. anomalies or incidents.
+	Spikes []Event `yaml:"spikes"`
+}
+
+// Event is a value change starting at given time.
+type Event struct {
+	// Time is a timestamp in milliseconds when event starts.
+	Time int64 `yaml:"time"`
+	// Duration of the event. Used only by spikes.
+	Duration time.Duration `yaml:"duration"`
+	// Value is added to the series value.
+	Value float64 `yaml:"value"`
+}
+
+var _ SeriesIterator = &PatternGen{}
+
+// PatternGen generates gauge samples with seasonality, trend, steps and spikes configured by Characteristics.Pattern.
+type PatternGen struct {
+	*GaugeGen
+
+	start int64
+	opts  PatternCharacteristics
+}
+
+func NewPatternGen(random *rand.Rand, mint, maxt int64, opts Characteristics) *PatternGen {
+	return &PatternGen{
+		GaugeGen: NewGaugeGen(random, mint, maxt, opts),
+		start:    mint,
+		opts:     opts.Pattern,
+	}
+}
+
+func (g *PatternGen) At() (t int64, v float64) {
+	t, v = g.GaugeGen.At()
+	return t, v + g.pattern(t)
+}
+
+func (g *PatternGen) pattern(t int64) (v float64) {
+	const (
+		day  = 24 * time.Hour
+		week = 7 * day
+	)
+	if g.opts.DailyAmplitude != 0 {
+		v += g.opts.DailyAmplitude * math.Cos(2*math.Pi*float64(t-(12*time.Hour).Milliseconds())/float64(day.Milliseconds()))
+	}
+	if g.opts.WeeklyAmplitude != 0 {
+		// Unix epoch was on Thursday.
+		v += g.opts.WeeklyAmplitude * math.Cos(2*math.Pi*float64(t)/float64(week.Milliseconds()))
+	}
+	v += g.opts.Trend * float64(t-g.start) / float64(time.Hour.Milliseconds())
+
+	for _, e := range g.opts.Steps {
+		if t >= e.Time {
+			v += e.Value
+		}
+	}
+	for _, e := range g.opts.Spikes {
+		if t >= e.Time && t < e.Time+e.Duration.Milliseconds() {
+			v += e.Value
+		}
+	}
+	return v
+}
@@ -0,0 +1,43 @@
+package seriesgen
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestPatternGen(t *testing.T) {
+	day := (24 * time.Hour).Milliseconds()
+	hour := time.Hour.Milliseconds()
+
+	// 2019-10-14 (Monday) 00:00 UTC.
+	mint := time.Date(2019, 10, 14, 0, 0, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond)
+	g := NewPatternGen(rand.New(rand.NewSource(1)), mint, mint+7*day, Characteristics{
+		ScrapeInterval: 15 * time.Minute,
+		Min:            100,
+		Max:            100,
+		Pattern: PatternCharacteristics{
+			DailyAmplitude: 50,
+			Trend:          1,
+			Steps:          []Event{{Time: mint + 2*day, Value: 1000}},
+			Spikes:         []Event{{Time: mint + 4*day, Duration: 24 * time.Hour, Value: 10000}},
+		},
+	})
+
+	values := map[int64]float64{}
+	for g.Next() {
+		ts, v := g.At()
+		values[ts] = v
+	}
+	testutil.Ok(t, g.Err())
+
+	// Base value is within [100, 101) with daily seasonality (-50 at midnight, +50 at noon) and trend.
+	near := func(exp, got float64) { testutil.Assert(t, got >= exp && got < exp+1, "expected %v, got %v", exp, got) }
+	near(100+50+12, values[mint+12*hour])
+	near(100-50+24, values[mint+day])
+	near(100-50+48+1000, values[mint+2*day])
+	near(100-50+96+1000+10000, values[mint+4*day])
+	near(100-50+120+1000, values[mint+5*day])
+}
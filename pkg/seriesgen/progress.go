@@ -0,0 +1,150 @@
+package seriesgen
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// ProgressHook is notified about progress of Append. It has to be safe for concurrent use.
+type ProgressHook interface {
+	// Appended is called after samples are appended. Series is the number of series fully appended since the last call.
+	Appended(series, samples int)
+}
+
+// ProgressStats is a snapshot of progress.
+type ProgressStats struct {
+	Series int64
+	// ExpectedSeries is the number of series to append or 0 if unknown.
+	ExpectedSeries int64
+	Samples        int64
+	Elapsed        time.Duration
+}
+
+// AppendsPerSecond returns average number of samples appended per second.
+func (s ProgressStats) AppendsPerSecond() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.Samples) / s.Elapsed.Seconds()
+}
+
+// ETA returns estimated remaining time, based on the ratio of appended series. It returns -1 if unknown.
+func (s ProgressStats) ETA() time.Duration {
+	if s.ExpectedSeries <= 0 || s.Series <= 0 {
+		return -1
+	}
+	if s.Series >= s.ExpectedSeries {
+		return 0
+	}
+	return time.Duration(float64(s.Elapsed) * float64(s.ExpectedSeries-s.Series) / float64(s.Series))
+}
+
+var _ ProgressHook = &Progress{}
+
+// Progress is a ProgressHook that tracks progress of Append runs and exposes it as Prometheus metrics.
+type Progress struct {
+	// Accessed atomically.
+	series, expectedSeries, samples, start int64
+
+	seriesTotal  prometheus.Counter
+	samplesTotal prometheus.Counter
+}
+
+// NewProgress returns progress with metrics registered in given registerer, which can be nil.
+func NewProgress(reg prometheus.Registerer) *Progress {
+	p := &Progress{
+		seriesTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanosbench_append_series_total",
+			Help: "Total number of fully appended series.",
+		}),
+		samplesTotal: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "thanosbench_append_samples_total",
+			Help: "Total number of appended samples.",
+		}),
+		start: time.Now().UnixNano(),
+	}
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanosbench_append_expected_series",
+		Help: "Number of series expected to be appended in the current run or 0 if unknown.",
+	}, func() float64 { return float64(p.Stats().ExpectedSeries) })
+	promauto.With(reg).NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "thanosbench_append_eta_seconds",
+		Help: "Estimated remaining time of the current run or -1 if unknown.",
+	}, func() float64 { return p.Stats().ETA().Seconds() })
+	return p
+}
+
+// Reset starts tracking a new run with given number of expected series, 0 if unknown. Metrics are not reset.
+func (p *Progress) Reset(expectedSeries int) {
+	atomic.StoreInt64(&p.series, 0)
+	atomic.StoreInt64(&p.samples, 0)
+	atomic.StoreInt64(&p.expectedSeries, int64(expectedSeries))
+	atomic.StoreInt64(&p.start, time.Now().UnixNano())
+}
+
+// Expect adds given number of series to expected series of the current run, so multiple concurrent appends can be
+// tracked as one run.
+func (p *Progress) Expect(series int) {
+	atomic.AddInt64(&p.expectedSeries, int64(series))
+}
+
+// Appended implements ProgressHook.
+func (p *Progress) Appended(series, samples int) {
+	atomic.AddInt64(&p.series, int64(series))
+	atomic.AddInt64(&p.samples, int64(samples))
+	p.seriesTotal.Add(float64(series))
+	p.samplesTotal.Add(float64(samples))
+}
+
+// Stats returns progress of the current run.
+func (p *Progress) Stats() ProgressStats {
+	return ProgressStats{
+		Series:         atomic.LoadInt64(&p.series),
+		ExpectedSeries: atomic.LoadInt64(&p.expectedSeries),
+		Samples:        atomic.LoadInt64(&p.samples),
+		Elapsed:        time.Since(time.Unix(0, atomic.LoadInt64(&p.start))),
+	}
+}
+
+// Log logs progress every interval until context is canceled. Nothing is logged if there was no progress since the last log,
+// e.g. while a block is flushed.
+func (p *Progress) Log(ctx context.Context, logger log.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last ProgressStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		s := p.Stats()
+		if s.Series == last.Series && s.Samples == last.Samples {
+			continue
+		}
+		last = s
+
+		keyvals := []interface{}{
+			"msg", "progress",
+			"series", s.Series,
+			"samples", s.Samples,
+			"appends_per_second", int64(s.AppendsPerSecond()),
+			"elapsed", s.Elapsed.Round(time.Second),
+		}
+		if s.ExpectedSeries > 0 {
+			keyvals = append(keyvals, "expected_series", s.ExpectedSeries)
+		}
+		if eta := s.ETA(); eta >= 0 {
+			keyvals = append(keyvals, "eta", eta.Round(time.Second))
+		}
+		level.Info(logger).Log(keyvals...)
+	}
+}
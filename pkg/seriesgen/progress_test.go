@@ -0,0 +1,45 @@
+package seriesgen
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestProgress(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p := NewProgress(reg)
+	p.Reset(4)
+	testutil.Equals(t, time.Duration(-1), p.Stats().ETA())
+
+	a := &testAppendable{samples: map[uint64][]sample{}}
+	testutil.Ok(t, Append(context.Background(), 2, a, &testSet{count: 2}, WithProgressHook(p)))
+
+	s := p.Stats()
+	testutil.Equals(t, int64(2), s.Series)
+	testutil.Equals(t, int64(4), s.ExpectedSeries)
+	testutil.Equals(t, int64(10), s.Samples)
+	testutil.Assert(t, s.AppendsPerSecond() > 0, "")
+	testutil.Assert(t, s.ETA() > 0 && s.ETA() <= s.Elapsed, "unexpected ETA %v for elapsed %v", s.ETA(), s.Elapsed)
+
+	testutil.Equals(t, 2.0, promtestutil.ToFloat64(p.seriesTotal))
+	testutil.Equals(t, 10.0, promtestutil.ToFloat64(p.samplesTotal))
+
+	// Metrics are cumulative across runs.
+	p.Reset(2)
+	testutil.Ok(t, Append(context.Background(), 2, a, &testSet{count: 2}, WithProgressHook(p)))
+	testutil.Equals(t, int64(2), p.Stats().Series)
+	testutil.Equals(t, time.Duration(0), p.Stats().ETA())
+	testutil.Equals(t, 4.0, promtestutil.ToFloat64(p.seriesTotal))
+	testutil.Equals(t, 20.0, promtestutil.ToFloat64(p.samplesTotal))
+
+	// Concurrent appends are tracked as one run.
+	p.Reset(0)
+	p.Expect(2)
+	p.Expect(2)
+	testutil.Equals(t, int64(4), p.Stats().ExpectedSeries)
+}
@@ -0,0 +1,205 @@
+package seriesgen
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+	"github.com/prometheus/prometheus/tsdb/tsdbutil"
+)
+
+var _ storage.Queryable = &Queryable{}
+
+// Queryable is a Prometheus storage.Queryable with generated series, so PromQL can be evaluated directly against
+// synthetic data without writing blocks.
+//
+// All samples are kept in memory, so it is meant for datasets that fit into memory, e.g. in Go benchmarks.
+type Queryable struct {
+	series []*memSeries
+}
+
+// NewQueryable generates all series of given set into memory. Samples of each series are sorted by timestamp,
+// so out-of-order generators are supported.
+func NewQueryable(set SeriesSet) (*Queryable, error) {
+	q := &Queryable{}
+	for set.Next() {
+		s, err := newMemSeries(set.At())
+		if err != nil {
+			return nil, errors.Wrapf(err, "generate series %s", set.At().Labels())
+		}
+		q.series = append(q.series, s)
+	}
+	if err := set.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(q.series, func(i, j int) bool { return labels.Compare(q.series[i].lset, q.series[j].lset) < 0 })
+	return q, nil
+}
+
+// Querier implements storage.Queryable.
+func (q *Queryable) Querier(_ context.Context, mint, maxt int64) (storage.Querier, error) {
+	return &querier{series: q.series, mint: mint, maxt: maxt}, nil
+}
+
+type memSeries struct {
+	lset    labels.Labels
+	samples memSamples
+}
+
+func newMemSeries(s Series) (*memSeries, error) {
+	m := &memSeries{lset: s.Labels()}
+
+	iter := s.Iterator()
+	hiter, isHistogram := iter.(HistogramIterator)
+	for iter.Next() {
+		if isHistogram {
+			t, h := hiter.AtHistogram()
+			m.samples = append(m.samples, memSample{t: t, h: h})
+			continue
+		}
+		t, v := iter.At()
+		m.samples = append(m.samples, memSample{t: t, v: v})
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	if !sort.IsSorted(m.samples) {
+		sort.Stable(m.samples)
+	}
+	return m, nil
+}
+
+// matches returns true if series labels match all given matchers. Missing labels are treated as empty.
+func (m *memSeries) matches(ms []*labels.Matcher) bool {
+	for _, matcher := range ms {
+		if !matcher.Matches(m.lset.Get(matcher.Name)) {
+			return false
+		}
+	}
+	return true
+}
+
+type querier struct {
+	series     []*memSeries
+	mint, maxt int64
+}
+
+// Select implements storage.Querier. Returned series are always sorted and contain only samples within
+// the selected time range.
+func (q *querier) Select(_ bool, hints *storage.SelectHints, ms ...*labels.Matcher) storage.SeriesSet {
+	mint, maxt := q.mint, q.maxt
+	if hints != nil {
+		mint, maxt = hints.Start, hints.End
+	}
+
+	var res []storage.Series
+	for _, s := range q.series {
+		if !s.matches(ms) {
+			continue
+		}
+		// Like TSDB, skip series without any samples in the range.
+		first := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].t >= mint })
+		last := sort.Search(len(s.samples), func(i int) bool { return s.samples[i].t > maxt })
+		if first >= last {
+			continue
+		}
+		samples := s.samples[first:last]
+		res = append(res, &storage.SeriesEntry{
+			Lset:             s.lset,
+			SampleIteratorFn: func() chunkenc.Iterator { return storage.NewListSeriesIterator(samples) },
+		})
+	}
+	return &querySeriesSet{series: res}
+}
+
+// LabelValues implements storage.LabelQuerier.
+func (q *querier) LabelValues(name string, ms ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	values := map[string]struct{}{}
+	for _, s := range q.series {
+		if v := s.lset.Get(name); v != "" && s.matches(ms) {
+			values[v] = struct{}{}
+		}
+	}
+	return sortedKeys(values), nil, nil
+}
+
+// LabelNames implements storage.LabelQuerier.
+func (q *querier) LabelNames(ms ...*labels.Matcher) ([]string, storage.Warnings, error) {
+	names := map[string]struct{}{}
+	for _, s := range q.series {
+		if !s.matches(ms) {
+			continue
+		}
+		for _, l := range s.lset {
+			names[l.Name] = struct{}{}
+		}
+	}
+	return sortedKeys(names), nil, nil
+}
+
+func (q *querier) Close() error { return nil }
+
+func sortedKeys(m map[string]struct{}) []string {
+	res := make([]string, 0, len(m))
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+type querySeriesSet struct {
+	series []storage.Series
+	curr   storage.Series
+}
+
+func (s *querySeriesSet) Next() bool {
+	if len(s.series) == 0 {
+		return false
+	}
+	s.curr, s.series = s.series[0], s.series[1:]
+	return true
+}
+
+func (s *querySeriesSet) At() storage.Series         { return s.curr }
+func (s *querySeriesSet) Err() error                 { return nil }
+func (s *querySeriesSet) Warnings() storage.Warnings { return nil }
+
+// memSamples implements storage.Samples without allocating on Get, so storage.NewListSeriesIterator
+// can be used to iterate and seek over them.
+type memSamples []memSample
+
+func (s memSamples) Get(i int) tsdbutil.Sample { return &s[i] }
+func (s memSamples) Len() int                  { return len(s) }
+func (s memSamples) Less(i, j int) bool        { return s[i].t < s[j].t }
+func (s memSamples) Swap(i, j int)             { s[i], s[j] = s[j], s[i] }
+
+// memSample is a float sample or, if h is not nil, a native histogram sample.
+type memSample struct {
+	t int64
+	v float64
+	h *histogram.Histogram
+}
+
+func (s *memSample) T() int64                { return s.t }
+func (s *memSample) V() float64              { return s.v }
+func (s *memSample) H() *histogram.Histogram { return s.h }
+
+func (s *memSample) FH() *histogram.FloatHistogram {
+	if s.h == nil {
+		return nil
+	}
+	return s.h.ToFloat()
+}
+
+func (s *memSample) Type() chunkenc.ValueType {
+	if s.h != nil {
+		return chunkenc.ValHistogram
+	}
+	return chunkenc.ValFloat
+}
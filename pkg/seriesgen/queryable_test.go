@@ -0,0 +1,80 @@
+package seriesgen
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/go-kit/log"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+func TestQueryable(t *testing.T) {
+	opts := Characteristics{ScrapeInterval: 15 * time.Second, Max: 100, Integer: true}
+	maxt := (10 * time.Minute).Milliseconds()
+
+	var series []Series
+	for _, job := range []string{"b", "a"} {
+		for _, instance := range []string{"1", "2"} {
+			random := rand.New(rand.NewSource(1))
+			series = append(series, NewSeriesGen(
+				labels.FromStrings("__name__", "up", "job", job, "instance", instance),
+				WithOutOfOrder(random, NewGaugeGen(random, 0, maxt, opts), Characteristics{OutOfOrder: OutOfOrderCharacteristics{Probability: 0.3, Window: time.Minute}}),
+			))
+		}
+	}
+	queryable, err := NewQueryable(&listSet{series: series})
+	testutil.Ok(t, err)
+	expected := collectIter(t, NewGaugeGen(rand.New(rand.NewSource(1)), 0, maxt, opts))
+
+	ctx := context.Background()
+	q, err := queryable.Querier(ctx, 0, 2*maxt)
+	testutil.Ok(t, err)
+	defer func() { testutil.Ok(t, q.Close()) }()
+
+	names, _, err := q.LabelNames()
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"__name__", "instance", "job"}, names)
+	values, _, err := q.LabelValues("instance", labels.MustNewMatcher(labels.MatchEqual, "job", "a"))
+	testutil.Ok(t, err)
+	testutil.Equals(t, []string{"1", "2"}, values)
+
+	set := q.Select(false, nil, labels.MustNewMatcher(labels.MatchRegexp, "job", "a|c"), labels.MustNewMatcher(labels.MatchNotEqual, "instance", "2"))
+	testutil.Assert(t, set.Next(), "")
+	testutil.Equals(t, labels.FromStrings("__name__", "up", "job", "a", "instance", "1"), set.At().Labels())
+
+	it := set.At().Iterator()
+	testutil.Equals(t, chunkenc.ValFloat, it.Seek(61000))
+	ts, v := it.At()
+	testutil.Equals(t, expected[4], sample{T: ts, V: v})
+	testutil.Equals(t, chunkenc.ValFloat, it.Seek(0))
+	testutil.Equals(t, int64(75000), it.AtT())
+	var got []sample
+	for vt := chunkenc.ValFloat; vt != chunkenc.ValNone; vt = it.Next() {
+		ts, v := it.At()
+		got = append(got, sample{T: ts, V: v})
+	}
+	testutil.Ok(t, it.Err())
+	testutil.Equals(t, expected[4:], got)
+	testutil.Assert(t, !set.Next(), "")
+	testutil.Ok(t, set.Err())
+
+	// Series without samples in the range are skipped.
+	q2, err := queryable.Querier(ctx, 2*maxt+1, 3*maxt)
+	testutil.Ok(t, err)
+	testutil.Assert(t, !q2.Select(true, nil, labels.MustNewMatcher(labels.MatchEqual, "__name__", "up")).Next(), "")
+
+	engine := promql.NewEngine(promql.EngineOpts{Logger: log.NewNopLogger(), MaxSamples: 1e6, Timeout: time.Minute})
+	query, err := engine.NewInstantQuery(queryable, nil, `sum by (job) (up)`, time.Unix(0, expected[len(expected)-1].T*int64(time.Millisecond)))
+	testutil.Ok(t, err)
+	res := query.Exec(ctx)
+	testutil.Ok(t, res.Err)
+	vector, err := res.Vector()
+	testutil.Ok(t, err)
+	testutil.Equals(t, 2, len(vector))
+	testutil.Equals(t, 2*expected[len(expected)-1].V, vector[0].V)
+}
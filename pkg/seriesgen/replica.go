@@ -0,0 +1,121 @@
+package seriesgen
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/exemplar"
+	"github.com/prometheus/prometheus/model/histogram"
+	"github.com/prometheus/prometheus/model/value"
+)
+
+// ReplicaCharacteristics configures differences of a HA replica from other replicas scraping the same targets.
+type ReplicaCharacteristics struct {
+	// Offset shifts all timestamps of replica, as replicas scrape the same targets at different times.
+	Offset time.Duration `yaml:"offset"`
+	// Drift is a maximum relative difference [0, 1) of float values from values of other replicas, e.g. 0.01 for 1%.
+	// It is applied to each sample independently, so it should be used only for gauges.
+	Drift float64 `yaml:"drift"`
+	// Gaps configures missed scrapes and outages of replica, independent of other replicas.
+	Gaps GapCharacteristics `yaml:"gaps"`
+}
+
+// WithReplica wraps given iterator so it yields samples as scraped by a replica. Samples shifted outside of
+// [mint, maxt] are dropped. Random has to be independent of the one used for values, so replicas differ.
+// Native histograms get only the offset, as they do not support gaps.
+func WithReplica(random *rand.Rand, iter SeriesIterator, mint, maxt int64, opts ReplicaCharacteristics) SeriesIterator {
+	g := &replicaGen{
+		SeriesIterator: iter,
+		offset:         opts.Offset.Milliseconds(),
+		mint:           mint,
+		maxt:           maxt,
+		drift:          opts.Drift,
+		random:         random,
+	}
+	if opts.Drift < 0 || opts.Drift >= 1 {
+		g.err = errors.Errorf("replica drift has to be within [0, 1), got %v", opts.Drift)
+	}
+
+	if hiter, ok := iter.(HistogramIterator); ok {
+		g.drift = 0
+		return &replicaHistogramGen{replicaGen: g, hiter: hiter}
+	}
+	out := WithGaps(random, g, Characteristics{Gaps: opts.Gaps})
+	if eiter, ok := iter.(ExemplarIterator); ok {
+		return &replicaExemplarGen{SeriesIterator: out, eiter: eiter, offset: g.offset}
+	}
+	return out
+}
+
+type replicaGen struct {
+	SeriesIterator
+
+	offset     int64
+	mint, maxt int64
+	drift      float64
+
+	t   int64
+	v   float64
+	err error
+
+	random *rand.Rand
+}
+
+func (g *replicaGen) Next() bool {
+	if g.err != nil {
+		return false
+	}
+	for g.SeriesIterator.Next() {
+		t, v := g.SeriesIterator.At()
+		t += g.offset
+		if t < g.mint {
+			continue
+		}
+		if t > g.maxt {
+			return false
+		}
+		if g.drift > 0 && !value.IsStaleNaN(v) {
+			v *= 1 + g.drift*(2*g.random.Float64()-1)
+		}
+		g.t, g.v = t, v
+		return true
+	}
+	return false
+}
+
+func (g *replicaGen) At() (int64, float64) { return g.t, g.v }
+
+func (g *replicaGen) Err() error {
+	if g.err != nil {
+		return g.err
+	}
+	return g.SeriesIterator.Err()
+}
+
+type replicaHistogramGen struct {
+	*replicaGen
+	hiter HistogramIterator
+}
+
+func (g *replicaHistogramGen) AtHistogram() (int64, *histogram.Histogram) {
+	_, h := g.hiter.AtHistogram()
+	return g.t, h
+}
+
+// replicaExemplarGen keeps exemplars of the wrapped iterator, which would be hidden by gaps.
+type replicaExemplarGen struct {
+	SeriesIterator
+	eiter  ExemplarIterator
+	offset int64
+}
+
+func (g *replicaExemplarGen) AtExemplar() (exemplar.Exemplar, bool) {
+	// Outage starts with staleness marker in place of the scraped sample.
+	if _, v := g.At(); value.IsStaleNaN(v) {
+		return exemplar.Exemplar{}, false
+	}
+	e, ok := g.eiter.AtExemplar()
+	e.Ts += g.offset
+	return e, ok
+}
@@ -0,0 +1,127 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/value"
+)
+
+func TestWithReplica(t *testing.T) {
+	opts := Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Min:            100,
+		Max:            200,
+		Exemplars:      ExemplarCharacteristics{Probability: 0.5},
+	}
+	maxt := (24 * time.Hour).Milliseconds()
+	stream := func() SeriesIterator {
+		random := rand.New(rand.NewSource(1))
+		return WithCharacteristics(random, NewGaugeGen(random, 0, maxt, opts), 0, maxt, opts)
+	}
+
+	type sample struct {
+		t int64
+		v float64
+	}
+	var expected []sample
+	for iter := stream(); iter.Next(); {
+		ts, v := iter.At()
+		expected = append(expected, sample{t: ts, v: v})
+	}
+
+	t.Run("offset", func(t *testing.T) {
+		lastT := expected[len(expected)-1].t
+		iter := WithReplica(rand.New(rand.NewSource(2)), stream(), 0, lastT, ReplicaCharacteristics{Offset: time.Second})
+		eiter, ok := iter.(ExemplarIterator)
+		testutil.Assert(t, ok, "expected exemplar iterator")
+
+		var got []sample
+		exemplars := 0
+		for iter.Next() {
+			ts, v := iter.At()
+			got = append(got, sample{t: ts, v: v})
+			if e, ok := eiter.AtExemplar(); ok {
+				exemplars++
+				testutil.Equals(t, ts, e.Ts)
+			}
+		}
+		testutil.Ok(t, iter.Err())
+		testutil.Assert(t, exemplars > 0, "expected exemplars")
+
+		// The last sample is shifted after maxt.
+		testutil.Equals(t, len(expected)-1, len(got))
+		for i := range got {
+			testutil.Equals(t, expected[i].t+1000, got[i].t)
+			testutil.Equals(t, expected[i].v, got[i].v)
+		}
+	})
+	t.Run("drift and gaps", func(t *testing.T) {
+		iter := WithReplica(rand.New(rand.NewSource(2)), stream(), 0, maxt, ReplicaCharacteristics{
+			Drift: 0.01,
+			Gaps:  GapCharacteristics{MissedScrapeProbability: 0.01, OutageProbability: 0.001, OutageMaxDuration: 10 * time.Minute},
+		})
+		byT := map[int64]float64{}
+		for _, s := range expected {
+			byT[s.t] = s.v
+		}
+
+		var samples, stale, drifted int
+		for iter.Next() {
+			samples++
+			ts, v := iter.At()
+			if value.IsStaleNaN(v) {
+				stale++
+				continue
+			}
+			ev, ok := byT[ts]
+			testutil.Assert(t, ok, "unexpected timestamp %v", ts)
+			testutil.Assert(t, math.Abs(v-ev) <= 0.01*math.Abs(ev), "value %v drifted too far from %v", v, ev)
+			if v != ev {
+				drifted++
+			}
+		}
+		testutil.Ok(t, iter.Err())
+		testutil.Assert(t, stale > 0, "expected outages")
+		testutil.Assert(t, samples < len(expected), "expected missed scrapes")
+		testutil.Assert(t, drifted > samples/2, "expected drifted values")
+	})
+	t.Run("histogram", func(t *testing.T) {
+		histogramStream := func() SeriesIterator {
+			return NewHistogramGen(rand.New(rand.NewSource(1)), 0, maxt, opts)
+		}
+		expected := histogramStream().(HistogramIterator)
+		testutil.Assert(t, expected.Next(), "")
+		firstT, _ := expected.AtHistogram()
+
+		iter := WithReplica(rand.New(rand.NewSource(2)), histogramStream(), firstT, maxt, ReplicaCharacteristics{
+			Offset: -time.Second,
+			Drift:  0.01,
+			Gaps:   GapCharacteristics{MissedScrapeProbability: 0.5},
+		})
+		hiter, ok := iter.(HistogramIterator)
+		testutil.Assert(t, ok, "expected histogram iterator")
+
+		// The first sample is shifted before mint.
+		for iter.Next() {
+			testutil.Assert(t, expected.Next(), "")
+			ets, eh := expected.AtHistogram()
+			ts, h := hiter.AtHistogram()
+			testutil.Equals(t, ets-1000, ts)
+			testutil.Equals(t, eh, h)
+		}
+		testutil.Ok(t, iter.Err())
+		// Remaining samples are after maxt.
+		for expected.Next() {
+			ets, _ := expected.AtHistogram()
+			testutil.Assert(t, ets-1000 > maxt, "missing sample at %v", ets)
+		}
+	})
+
+	iter := WithReplica(rand.New(rand.NewSource(2)), stream(), 0, maxt, ReplicaCharacteristics{Drift: 1})
+	testutil.Assert(t, !iter.Next(), "")
+	testutil.NotOk(t, iter.Err())
+}
@@ -1,9 +1,11 @@
 package seriesgen
 
 import (
+	"math"
 	"math/rand"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/prometheus/prometheus/model/labels"
 )
 
@@ -54,7 +56,8 @@ func NewSeriesGen(lset labels.Labels, si SeriesIterator) *SeriesGen {
 }
 func (s *SeriesGen) Labels() labels.Labels { return s.lset }
 
-func (s *SeriesGen) Iterator() SeriesIterator { return s }
+// Iterator returns the underlying iterator, so optional interfaces like HistogramIterator are preserved.
+func (s *SeriesGen) Iterator() SeriesIterator { return s.SeriesIterator }
 
 var _ SeriesIterator = &GaugeGen{}
 var _ SeriesIterator = &CounterGen{}
@@ -66,6 +69,66 @@ type Characteristics struct {
 	ChangeInterval time.Duration `yaml:"changeInterval"`
 	Max            float64       `yaml:"max"`
 	Min            float64       `yaml:"min"`
+
+	// Distribution of values between Min and Max. If empty, UNIFORM is used.
+	Distribution Distribution `yaml:"distribution"`
+	// Integer rounds all generated values (and counter increments) to integers.
+	Integer bool `yaml:"integer"`
+
+	// Rate is a target per-second increase of counters. If 0, random rate between Min and Max is used.
+	Rate float64 `yaml:"rate"`
+	// Resets configures counter resets.
+	Resets ResetCharacteristics `yaml:"resets"`
+
+	// Pattern configures seasonality, trend and events. Used only by PatternGen.
+	Pattern PatternCharacteristics `yaml:"pattern"`
+
+	// Exemplars configures exemplars attached to samples. Used by WithExemplars.
+	Exemplars ExemplarCharacteristics `yaml:"exemplars"`
+	// SpecialValues configures injection of special float values and precision. Used by WithSpecialValues.
+	SpecialValues SpecialValueCharacteristics `yaml:"specialValues"`
+	// Timestamps configures timestamp jitter and offsets. Used by WithTimestampJitter.
+	Timestamps TimestampCharacteristics `yaml:"timestamps"`
+	// Gaps configures missed scrapes and outages. Used by WithGaps.
+	Gaps GapCharacteristics `yaml:"gaps"`
+	// OutOfOrder configures reordering of samples. Used by WithOutOfOrder.
+	OutOfOrder OutOfOrderCharacteristics `yaml:"outOfOrder"`
+
+	// Histogram configures native histograms, classic histograms and summaries.
+	Histogram HistogramCharacteristics `yaml:"histogram"`
+}
+
+// WithCharacteristics wraps given iterator with all optional characteristics not specific to any generator,
+// so special values, timestamp irregularities, gaps, out-of-order samples and exemplars. Timestamps are kept within
+// [mint, maxt] of the series.
+func WithCharacteristics(random *rand.Rand, iter SeriesIterator, mint, maxt int64, opts Characteristics) SeriesIterator {
+	iter = WithSpecialValues(random, iter, opts)
+	iter = WithTimestampJitter(random, iter, mint, maxt, opts)
+	iter = WithGaps(random, iter, opts)
+	iter = WithOutOfOrder(random, iter, opts)
+	// Exemplars have to be last, so Append can see them.
+	return WithExemplars(random, iter, opts)
+}
+
+type ResetType string
+
+const (
+	NoResets ResetType = ""
+	// PeriodicResets resets counter every interval, e.g. as restarts during regular rollouts.
+	PeriodicResets ResetType = "PERIODIC"
+	// RandomResets resets counter on each scrape with given probability, e.g. as crashes.
+	RandomResets ResetType = "RANDOM"
+	// ChangeIntervalResets resets counter every change interval, together with rate change.
+	ChangeIntervalResets ResetType = "CHANGE_INTERVAL"
+)
+
+// ResetCharacteristics configures counter resets.
+type ResetCharacteristics struct {
+	Type ResetType `yaml:"type"`
+	// Interval between resets. Used only by PERIODIC type.
+	Interval time.Duration `yaml:"interval"`
+	// Probability of reset on each scrape. Used only by RANDOM type.
+	Probability float64 `yaml:"probability"`
 }
 
 type GaugeGen struct {
@@ -73,31 +136,34 @@ type GaugeGen struct {
 	interval         time.Duration
 	maxTime, minTime int64
 
-	min, max, jitter float64
+	jitter  float64
+	sampler *valueSampler
 
 	v       float64
 	mod     float64
 	init    bool
 	elapsed int64
+	err     error
 
 	random *rand.Rand
 }
 
 func NewGaugeGen(random *rand.Rand, mint, maxt int64, opts Characteristics) *GaugeGen {
+	sampler, err := newValueSampler(random, opts)
 	return &GaugeGen{
 		changeInterval: opts.ChangeInterval,
 		interval:       opts.ScrapeInterval,
-		max:            opts.Max,
-		min:            opts.Min,
 		minTime:        mint,
 		maxTime:        maxt,
 		jitter:         opts.Jitter,
+		sampler:        sampler,
+		err:            err,
 		random:         random,
 	}
 }
 
 func (g *GaugeGen) Next() bool {
-	if g.minTime > g.maxTime {
+	if g.err != nil || g.minTime > g.maxTime {
 		return false
 	}
 	defer func() {
@@ -106,7 +172,7 @@ func (g *GaugeGen) Next() bool {
 	}()
 
 	if !g.init {
-		g.v = g.min + g.random.Float64()*((g.max-g.min)+1)
+		g.v = g.sampler.sample()
 		g.init = true
 	}
 
@@ -119,130 +185,157 @@ func (g *GaugeGen) Next() bool {
 }
 
 func (g *GaugeGen) At() (t int64, v float64) {
-	return g.minTime, g.v + g.mod
+	return g.minTime, g.sampler.round(g.v + g.mod)
 }
 
-func (g *GaugeGen) Err() error { return nil }
+func (g *GaugeGen) Err() error { return g.err }
 
-// TODO(bwplotka): Improve. Does not work well (: Too naive.
-// Add resets etc.
+// CounterGen generates counter samples increasing with a given per-second rate. Rate changes by jitter every
+// change interval, and counter resets happen according to Characteristics.Resets.
 type CounterGen struct {
-	maxTime, minTime int64
-
-	min, max, jitter float64
 	interval         time.Duration
 	changeInterval   time.Duration
-	rateInterval     time.Duration
+	maxTime, minTime int64
 
-	v    float64
-	init bool
-	buff []sample
+	jitter  float64
+	rate    float64
+	resets  ResetCharacteristics
+	sampler *valueSampler
 
-	lastVal float64
-	elapsed int64
+	v          float64
+	mod        float64
+	init       bool
+	elapsed    int64
+	sinceReset int64
+	err        error
 
 	random *rand.Rand
 }
 
 func NewCounterGen(random *rand.Rand, mint, maxt int64, opts Characteristics) *CounterGen {
+	sampler, err := newValueSampler(random, opts)
 	return &CounterGen{
 		changeInterval: opts.ChangeInterval,
 		interval:       opts.ScrapeInterval,
-		max:            opts.Max,
-		min:            opts.Min,
 		minTime:        mint,
 		maxTime:        maxt,
 		jitter:         opts.Jitter,
+		rate:           opts.Rate,
+		resets:         opts.Resets,
+		sampler:        sampler,
+		err:            err,
 		random:         random,
-		rateInterval:   5 * time.Minute,
 	}
 }
 
-func (g *CounterGen) Next() bool {
-	defer func() { g.elapsed += int64(g.interval.Seconds() * 1000) }()
-
-	if g.init && len(g.buff) == 0 {
-		return false
+func (g *CounterGen) validate() error {
+	switch g.resets.Type {
+	case NoResets:
+	case PeriodicResets:
+		if g.resets.Interval <= 0 {
+			return errors.Errorf("%s resets require positive interval, got %v", g.resets.Type, g.resets.Interval)
+		}
+	case RandomResets:
+		if g.resets.Probability < 0 || g.resets.Probability > 1 {
+			return errors.Errorf("%s resets require probability within [0, 1], got %v", g.resets.Type, g.resets.Probability)
+		}
+	case ChangeIntervalResets:
+		if g.changeInterval <= 0 {
+			return errors.Errorf("%s resets require positive change interval, got %v", g.resets.Type, g.changeInterval)
+		}
+	default:
+		return errors.Errorf("unknown reset type: %s", string(g.resets.Type))
 	}
+	return nil
+}
 
-	if len(g.buff) > 0 {
-		// Pop front.
-		g.buff = g.buff[1:]
-
-		if len(g.buff) > 0 {
-			return true
-		}
+func (g *CounterGen) Next() bool {
+	if g.err != nil || g.minTime > g.maxTime {
+		return false
 	}
+	defer func() {
+		g.minTime += int64(g.interval.Seconds() * 1000)
+		g.elapsed += int64(g.interval.Seconds() * 1000)
+		g.sinceReset += int64(g.interval.Seconds() * 1000)
+	}()
 
 	if !g.init {
-		g.v = g.min + g.random.Float64()*((g.max-g.min)+1)
+		if err := g.validate(); err != nil {
+			g.err = err
+			return false
+		}
+		if g.rate == 0 {
+			g.rate = g.sampler.sample()
+		}
+		// Counters usually exist for some time already.
+		g.v = g.sampler.round(g.random.Float64() * g.rate * time.Hour.Seconds())
+		// Spread periodic restarts of different series.
+		g.sinceReset = int64(g.random.Float64() * g.resets.Interval.Seconds() * 1000)
 		g.init = true
 	}
 
-	var mod float64
-	if g.jitter > 0 && g.elapsed >= int64(g.changeInterval.Seconds()*1000) {
-		mod = (g.random.Float64() - 0.5) * g.jitter
-
-		if mod > g.v {
-			mod = g.v
-		}
-
+	changed := g.elapsed >= int64(g.changeInterval.Seconds()*1000)
+	if changed {
 		g.elapsed = 0
+		if g.jitter > 0 {
+			g.mod = (g.random.Float64() - 0.5) * g.jitter
+		}
 	}
 
-	// Distribute goalV into multiple rateInterval/interval increments.
-	comps := make([]float64, int64(g.rateInterval/g.interval))
-	var sum float64
-	for i := range comps {
-		comps[i] = g.random.Float64()
-		sum += comps[i]
-	}
-
-	// That's the goal for our rate.
-	x := g.v + mod/sum
-	for g.minTime <= g.maxTime && len(comps) > 0 {
-		g.lastVal += x * comps[0]
-		comps = comps[1:]
+	inc := g.sampler.round(math.Max(0, g.rate+g.mod) * g.interval.Seconds() * (0.5 + g.random.Float64()))
 
-		g.minTime += int64(g.interval.Seconds() * 1000)
-		g.buff = append(g.buff, sample{T: g.minTime, V: g.lastVal})
+	var reset bool
+	switch g.resets.Type {
+	case PeriodicResets:
+		reset = g.sinceReset >= int64(g.resets.Interval.Seconds()*1000)
+	case RandomResets:
+		reset = g.random.Float64() < g.resets.Probability
+	case ChangeIntervalResets:
+		reset = changed
+	}
+	if !reset {
+		g.v += inc
+		return true
 	}
 
-	return len(g.buff) > 0
+	// Process restarted somewhere within last scrape interval.
+	g.v = g.sampler.round(inc * g.random.Float64())
+	g.sinceReset = 0
+	return true
 }
 
-func (g *CounterGen) At() (int64, float64) { return g.buff[0].T, g.buff[0].V }
+func (g *CounterGen) At() (int64, float64) { return g.minTime, g.v }
 
-func (g *CounterGen) Err() error { return nil }
+func (g *CounterGen) Err() error { return g.err }
 
 type ValGen struct {
 	interval         time.Duration
 	maxTime, minTime int64
 
-	min, max float64
+	sampler *valueSampler
 
-	v      float64
-	random *rand.Rand
+	v   float64
+	err error
 }
 
 func NewValGen(random *rand.Rand, mint, maxt int64, opts Characteristics) *ValGen {
+	sampler, err := newValueSampler(random, opts)
 	return &ValGen{
 		interval: opts.ScrapeInterval,
-		max:      opts.Max,
-		min:      opts.Min,
 		minTime:  mint,
 		maxTime:  maxt,
-		random:   random,
+		sampler:  sampler,
+		err:      err,
 	}
 }
 
 func (g *ValGen) Next() bool {
-	if g.minTime > g.maxTime {
+	if g.err != nil || g.minTime > g.maxTime {
 		return false
 	}
 
 	g.minTime += int64(g.interval.Seconds() * 1000)
-	g.v = g.min + g.random.Float64()*((g.max-g.min)+1)
+	g.v = g.sampler.sample()
 
 	return true
 }
@@ -251,4 +344,4 @@ func (g *ValGen) At() (t int64, v float64) {
 	return g.minTime, g.v
 }
 
-func (g *ValGen) Err() error { return nil }
+func (g *ValGen) Err() error { return g.err }
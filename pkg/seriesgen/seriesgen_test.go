@@ -5,7 +5,8 @@ import (
 	"testing"
 	"time"
 
-	"github.com/thanos-io/thanos/pkg/testutil"
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/histogram"
 )
 
 func TestCounterGen(t *testing.T) {
@@ -34,6 +35,82 @@ func TestCounterGen(t *testing.T) {
 	testutil.Equals(t, int64((24*time.Hour)/(15*time.Second)), samples)
 }
 
+func TestCounterGen_RateAndResets(t *testing.T) {
+	for _, tcase := range []struct {
+		name   string
+		resets ResetCharacteristics
+
+		expectedResets int
+		expectedErr    bool
+	}{
+		{name: "no resets"},
+		{
+			name:           "periodic",
+			resets:         ResetCharacteristics{Type: PeriodicResets, Interval: 6 * time.Hour},
+			expectedResets: 4,
+		},
+		{
+			name:           "change interval",
+			resets:         ResetCharacteristics{Type: ChangeIntervalResets},
+			expectedResets: 23,
+		},
+		{
+			name:           "random",
+			resets:         ResetCharacteristics{Type: RandomResets, Probability: 0.001},
+			expectedResets: 4,
+		},
+		{
+			name:        "periodic without interval",
+			resets:      ResetCharacteristics{Type: PeriodicResets},
+			expectedErr: true,
+		},
+		{
+			name:        "unknown",
+			resets:      ResetCharacteristics{Type: "unknown"},
+			expectedErr: true,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			g := NewCounterGen(rand.New(rand.NewSource(1)), 100, int64((24*time.Hour).Seconds())*1000, Characteristics{
+				ScrapeInterval: 15 * time.Second,
+				ChangeInterval: 1 * time.Hour,
+				Rate:           10,
+				Resets:         tcase.resets,
+			})
+
+			var (
+				resets, samples int
+				lastV, increase float64
+				first           = true
+			)
+			for g.Next() {
+				samples++
+				_, v := g.At()
+				if first {
+					first = false
+				} else if v < lastV {
+					resets++
+					increase += v
+				} else {
+					increase += v - lastV
+				}
+				lastV = v
+			}
+			if tcase.expectedErr {
+				testutil.NotOk(t, g.Err())
+				return
+			}
+			testutil.Ok(t, g.Err())
+			testutil.Equals(t, int((24*time.Hour)/(15*time.Second)), samples)
+			testutil.Equals(t, tcase.expectedResets, resets)
+
+			// Average rate should be close to the target.
+			rate := increase / (24 * time.Hour).Seconds()
+			testutil.Assert(t, rate > 9 && rate < 11, "unexpected rate %v", rate)
+		})
+	}
+}
+
 func TestGaugeGen(t *testing.T) {
 	g := NewGaugeGen(rand.New(rand.NewSource(1)), 100, int64((24*time.Hour).Seconds())*1000, Characteristics{
 		Jitter:         300,
@@ -59,3 +136,51 @@ func TestGaugeGen(t *testing.T) {
 	}
 	testutil.Equals(t, int64((24*time.Hour)/(15*time.Second)), samples)
 }
+
+func TestHistogramGen(t *testing.T) {
+	g := NewHistogramGen(rand.New(rand.NewSource(1)), 100, int64((24*time.Hour).Seconds())*1000, Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Min:            0.01,
+		Histogram: HistogramCharacteristics{
+			Schema:          3,
+			Buckets:         20,
+			Sparsity:        0.5,
+			ObservationRate: 100,
+		},
+	})
+
+	var (
+		last    *histogram.Histogram
+		lastT   int64
+		samples int64
+	)
+	for g.Next() {
+		samples++
+		ts, h := g.AtHistogram()
+		testutil.Equals(t, int32(3), h.Schema)
+
+		var count uint64
+		for it := h.PositiveBucketIterator(); it.Next(); {
+			count += it.At().Count
+		}
+		testutil.Equals(t, h.Count, count)
+
+		if last != nil {
+			testutil.Assert(t, lastT < ts, "")
+			testutil.Assert(t, last.Count <= h.Count, "")
+			testutil.Assert(t, last.Sum <= h.Sum, "")
+			testutil.Assert(t, !h.ToFloat().DetectReset(last.ToFloat()), "")
+		}
+		last, lastT = h, ts
+	}
+	testutil.Ok(t, g.Err())
+	testutil.Equals(t, int64((24*time.Hour)/(15*time.Second)), samples)
+	testutil.Assert(t, last.Count > 0, "")
+
+	g = NewHistogramGen(rand.New(rand.NewSource(1)), 0, 1000, Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Histogram:      HistogramCharacteristics{Schema: 9},
+	})
+	testutil.Assert(t, !g.Next(), "")
+	testutil.NotOk(t, g.Err())
+}
@@ -0,0 +1,136 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+type SpecialValue string
+
+const (
+	NaNValue    SpecialValue = "NAN"
+	PosInfValue SpecialValue = "INF"
+	NegInfValue SpecialValue = "NEG_INF"
+	// NegZeroValue is -0, which differs from 0 only in the sign bit.
+	NegZeroValue SpecialValue = "NEG_ZERO"
+	// DenormalValue is a random subnormal number.
+	DenormalValue SpecialValue = "DENORMAL"
+	// LongMantissaValue is the original value with all mantissa bits randomized.
+	LongMantissaValue SpecialValue = "LONG_MANTISSA"
+	// HugeExponentValue is a random number close to the biggest or smallest normal float64 numbers.
+	HugeExponentValue SpecialValue = "HUGE_EXPONENT"
+)
+
+// AllSpecialValues are injected when SpecialValueCharacteristics.Values is empty.
+var AllSpecialValues = []SpecialValue{NaNValue, PosInfValue, NegInfValue, NegZeroValue, DenormalValue, LongMantissaValue, HugeExponentValue}
+
+// SpecialValueCharacteristics configures special float values and precision of generated values.
+// Used to stress chunk encoding and PromQL edge cases.
+type SpecialValueCharacteristics struct {
+	// Probability of replacing each value by a random special value.
+	Probability float64 `yaml:"probability"`
+	// Values is a set of special values to inject. If empty, AllSpecialValues are used.
+	Values []SpecialValue `yaml:"values"`
+
+	// SignificantDigits rounds all values, except special ones, to given number of significant decimal digits.
+	// Values with less digits compress better. If 0, values are not rounded.
+	SignificantDigits int `yaml:"significantDigits"`
+}
+
+// WithSpecialValues wraps given iterator so its values are replaced by special values and rounded
+// according to opts.SpecialValues. Iterator is returned unchanged if nothing is configured.
+func WithSpecialValues(random *rand.Rand, iter SeriesIterator, opts Characteristics) SeriesIterator {
+	if opts.SpecialValues.Probability == 0 && opts.SpecialValues.SignificantDigits == 0 {
+		return iter
+	}
+
+	g := &specialValueGen{SeriesIterator: iter, opts: opts.SpecialValues, random: random}
+	if len(g.opts.Values) == 0 {
+		g.opts.Values = AllSpecialValues
+	}
+	g.err = g.validate()
+	return g
+}
+
+type specialValueGen struct {
+	SeriesIterator
+
+	opts SpecialValueCharacteristics
+
+	t   int64
+	v   float64
+	err error
+
+	random *rand.Rand
+}
+
+func (g *specialValueGen) validate() error {
+	if g.opts.Probability < 0 || g.opts.Probability > 1 {
+		return errors.Errorf("special value probability has to be within [0, 1], got %v", g.opts.Probability)
+	}
+	if g.opts.SignificantDigits < 0 || g.opts.SignificantDigits > 17 {
+		return errors.Errorf("significant digits have to be within [0, 17], got %v", g.opts.SignificantDigits)
+	}
+	for _, v := range g.opts.Values {
+		switch v {
+		case NaNValue, PosInfValue, NegInfValue, NegZeroValue, DenormalValue, LongMantissaValue, HugeExponentValue:
+		default:
+			return errors.Errorf("unknown special value: %s", string(v))
+		}
+	}
+	return nil
+}
+
+func (g *specialValueGen) Next() bool {
+	if g.err != nil || !g.SeriesIterator.Next() {
+		return false
+	}
+
+	g.t, g.v = g.SeriesIterator.At()
+	if g.opts.SignificantDigits > 0 {
+		g.v, _ = strconv.ParseFloat(strconv.FormatFloat(g.v, 'g', g.opts.SignificantDigits, 64), 64)
+	}
+	if g.opts.Probability > 0 && g.random.Float64() < g.opts.Probability {
+		g.v = g.special(g.opts.Values[g.random.Intn(len(g.opts.Values))], g.v)
+	}
+	return true
+}
+
+const mantissaMask = 1<<52 - 1
+
+func (g *specialValueGen) special(s SpecialValue, v float64) float64 {
+	switch s {
+	case NaNValue:
+		return math.NaN()
+	case PosInfValue:
+		return math.Inf(+1)
+	case NegInfValue:
+		return math.Inf(-1)
+	case NegZeroValue:
+		return math.Copysign(0, -1)
+	case DenormalValue:
+		// Zero exponent and non-zero mantissa.
+		return math.Float64frombits(uint64(g.random.Int63n(mantissaMask)) + 1)
+	case LongMantissaValue:
+		return math.Float64frombits(math.Float64bits(v)&^mantissaMask | uint64(g.random.Int63n(mantissaMask+1)))
+	case HugeExponentValue:
+		exp := 1000 + g.random.Intn(23)
+		if g.random.Intn(2) == 0 {
+			exp = -exp
+		}
+		return math.Ldexp(1+g.random.Float64(), exp)
+	}
+	return v
+}
+
+func (g *specialValueGen) At() (t int64, v float64) { return g.t, g.v }
+
+func (g *specialValueGen) Err() error {
+	if g.err != nil {
+		return g.err
+	}
+	return g.SeriesIterator.Err()
+}
@@ -0,0 +1,62 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+	"github.com/prometheus/prometheus/model/value"
+)
+
+func TestWithSpecialValues(t *testing.T) {
+	opts := Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Min:            100,
+		Max:            200,
+		SpecialValues: SpecialValueCharacteristics{
+			Probability:       0.1,
+			SignificantDigits: 3,
+		},
+	}
+	random := rand.New(rand.NewSource(1))
+	iter := WithSpecialValues(random, NewValGen(random, 0, int64((24*time.Hour).Seconds())*1000, opts), opts)
+
+	found := map[SpecialValue]int{}
+	var samples, regular int
+	for iter.Next() {
+		samples++
+		_, v := iter.At()
+		switch {
+		case value.IsStaleNaN(v):
+			t.Fatal("unexpected stale marker")
+		case math.IsNaN(v):
+			found[NaNValue]++
+		case math.IsInf(v, +1):
+			found[PosInfValue]++
+		case math.IsInf(v, -1):
+			found[NegInfValue]++
+		case v == 0 && math.Signbit(v):
+			found[NegZeroValue]++
+		case v != 0 && math.Abs(v) < 0x1p-1022:
+			found[DenormalValue]++
+		case math.Abs(v) > 1e300 || math.Abs(v) < 1e-300:
+			found[HugeExponentValue]++
+		case v >= 100 && v < 201 && v == math.Round(v):
+			regular++
+		default:
+			found[LongMantissaValue]++
+		}
+	}
+	testutil.Ok(t, iter.Err())
+	for _, s := range AllSpecialValues {
+		testutil.Assert(t, found[s] > 0, "expected %s values", s)
+	}
+	testutil.Assert(t, regular > samples*8/10, "expected most values to be regular and rounded, got %v of %v", regular, samples)
+
+	opts.SpecialValues.Values = []SpecialValue{"unknown"}
+	iter = WithSpecialValues(random, NewValGen(random, 0, 1000, opts), opts)
+	testutil.Assert(t, !iter.Next(), "")
+	testutil.NotOk(t, iter.Err())
+}
@@ -0,0 +1,119 @@
+package seriesgen
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// TimestampCharacteristics configures irregularities of scrape timestamps.
+type TimestampCharacteristics struct {
+	// Jitter is a scale of timestamp deviations from regular scrape interval, e.g. 2ms. Deviations are
+	// always smaller than half of the scrape interval, so samples keep their order.
+	Jitter time.Duration `yaml:"jitter"`
+	// JitterDistribution is a distribution of deviations. For UNIFORM (default) deviation is within [-Jitter, Jitter],
+	// for NORMAL Jitter is a standard deviation and for EXPONENTIAL it is a mean delay.
+	JitterDistribution Distribution `yaml:"jitterDistribution"`
+
+	// RandomOffset shifts all timestamps of series by a random offset within scrape interval, similar to
+	// how Prometheus spreads scrapes of different targets.
+	RandomOffset bool `yaml:"randomOffset"`
+}
+
+// WithTimestampJitter wraps given iterator so its timestamps are shifted according to opts.Timestamps. Samples shifted
+// outside of [mint, maxt] are dropped. Iterator is returned unchanged if no irregularities are configured.
+func WithTimestampJitter(random *rand.Rand, iter SeriesIterator, mint, maxt int64, opts Characteristics) SeriesIterator {
+	if opts.Timestamps == (TimestampCharacteristics{}) {
+		return iter
+	}
+
+	g := &jitterGen{
+		SeriesIterator: iter,
+		opts:           opts.Timestamps,
+		maxDeviation:   opts.ScrapeInterval.Milliseconds()/2 - 1,
+		mint:           mint,
+		maxt:           maxt,
+		random:         random,
+	}
+	if opts.ScrapeInterval.Milliseconds() < 2 {
+		g.err = errors.Errorf("timestamp irregularities require scrape interval of at least 2ms, got %v", opts.ScrapeInterval)
+		return g
+	}
+	switch g.opts.JitterDistribution {
+	case "", UniformDistribution, NormalDistribution, ExponentialDistribution:
+	default:
+		g.err = errors.Errorf("unsupported jitter distribution: %s", string(g.opts.JitterDistribution))
+	}
+	if g.opts.RandomOffset {
+		g.offset = random.Int63n(opts.ScrapeInterval.Milliseconds())
+	}
+	return g
+}
+
+type jitterGen struct {
+	SeriesIterator
+
+	opts         TimestampCharacteristics
+	maxDeviation int64
+	mint, maxt   int64
+
+	offset int64
+	t      int64
+	err    error
+
+	random *rand.Rand
+}
+
+func (g *jitterGen) Next() bool {
+	if g.err != nil {
+		return false
+	}
+	for g.SeriesIterator.Next() {
+		t, _ := g.SeriesIterator.At()
+		t += g.offset + g.deviation()
+		if t < g.mint {
+			continue
+		}
+		if t > g.maxt {
+			// Samples keep their order, so all following ones are after maxt too.
+			return false
+		}
+		g.t = t
+		return true
+	}
+	return false
+}
+
+func (g *jitterGen) deviation() int64 {
+	if g.opts.Jitter <= 0 {
+		return 0
+	}
+
+	jitter := float64(g.opts.Jitter.Milliseconds())
+	var d float64
+	switch g.opts.JitterDistribution {
+	case NormalDistribution:
+		d = g.random.NormFloat64() * jitter
+	case ExponentialDistribution:
+		d = g.random.ExpFloat64() * jitter
+	default:
+		d = (2*g.random.Float64() - 1) * jitter
+	}
+
+	max := float64(g.maxDeviation)
+	return int64(math.Round(math.Max(-max, math.Min(max, d))))
+}
+
+func (g *jitterGen) At() (t int64, v float64) {
+	_, v = g.SeriesIterator.At()
+	return g.t, v
+}
+
+func (g *jitterGen) Err() error {
+	if g.err != nil {
+		return g.err
+	}
+	return g.SeriesIterator.Err()
+}
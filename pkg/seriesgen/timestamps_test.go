@@ -0,0 +1,79 @@
+package seriesgen
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/efficientgo/core/testutil"
+)
+
+func TestWithTimestampJitter(t *testing.T) {
+	for _, dist := range []Distribution{UniformDistribution, NormalDistribution, ExponentialDistribution} {
+		t.Run(string(dist), func(t *testing.T) {
+			opts := Characteristics{
+				ScrapeInterval: 15 * time.Second,
+				Min:            100,
+				Max:            200,
+				Timestamps: TimestampCharacteristics{
+					Jitter:             10 * time.Second,
+					JitterDistribution: dist,
+					RandomOffset:       true,
+				},
+			}
+			random := rand.New(rand.NewSource(1))
+			maxt := (24 * time.Hour).Milliseconds()
+			iter := WithTimestampJitter(random, NewGaugeGen(random, 0, maxt, opts), 0, maxt, opts)
+
+			var (
+				samples, irregular int
+				lastT              int64
+			)
+			for iter.Next() {
+				samples++
+				ts, _ := iter.At()
+				if samples > 1 {
+					testutil.Assert(t, ts-lastT > 0 && ts-lastT < 30000, "unexpected interval: %v", ts-lastT)
+					if ts-lastT != 15000 {
+						irregular++
+					}
+				}
+				lastT = ts
+			}
+			testutil.Ok(t, iter.Err())
+			// The last samples are shifted after maxt, by less than two scrape intervals, and dropped.
+			expected := int((24*time.Hour)/(15*time.Second)) + 1
+			testutil.Assert(t, samples < expected && samples >= expected-3, "expected %v-%v samples, got %v", expected-3, expected-1, samples)
+			testutil.Assert(t, irregular > samples/2, "expected irregular intervals, got %v", irregular)
+		})
+	}
+
+	iter := WithTimestampJitter(rand.New(rand.NewSource(1)), NewGaugeGen(rand.New(rand.NewSource(1)), 0, 1000, Characteristics{}), 0, 1000, Characteristics{
+		Timestamps: TimestampCharacteristics{Jitter: time.Second},
+	})
+	testutil.Assert(t, !iter.Next(), "")
+	testutil.NotOk(t, iter.Err())
+}
+
+func TestWithTimestampJitter_MaxTime(t *testing.T) {
+	opts := Characteristics{
+		ScrapeInterval: 15 * time.Second,
+		Max:            100,
+		Timestamps:     TimestampCharacteristics{Jitter: 7 * time.Second, RandomOffset: true},
+	}
+	maxt := (10 * time.Minute).Milliseconds()
+	for seed := int64(0); seed < 20; seed++ {
+		random := rand.New(rand.NewSource(seed))
+		// Generator yields samples up to one scrape interval after maxt, offset and jitter move them further.
+		iter := WithTimestampJitter(random, NewGaugeGen(random, 0, maxt, opts), 0, maxt, opts)
+
+		samples := 0
+		for iter.Next() {
+			ts, _ := iter.At()
+			testutil.Assert(t, ts >= 0 && ts <= maxt, "sample %v outside of [0, %v]", ts, maxt)
+			samples++
+		}
+		testutil.Ok(t, iter.Err())
+		testutil.Assert(t, samples >= 38, "expected at least 38 samples, got %v", samples)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/pkg/errors"
 	"github.com/prometheus/common/model"
 	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
 	"github.com/prometheus/prometheus/model/timestamp"
 	"github.com/prometheus/prometheus/tsdb"
 	"github.com/thanos-io/thanosbench/pkg/seriesgen"
@@ -24,10 +25,39 @@ type Config struct {
 	InputSeries    []Series
 	Retention      time.Duration
 	ScrapeInterval time.Duration
+	// MaxExemplars is the size of the exemplar storage. If 0 and any series has exemplars configured, 100000 is used.
+	MaxExemplars int64
+	// OutOfOrderTimeWindow is the TSDB out-of-order time window. If 0, the biggest out-of-order window of series is used.
+	OutOfOrderTimeWindow time.Duration
+	// Seed changes values of all series, while keeping their labels. Configs with the same seed and MaxTime generate
+	// the same data.
+	Seed int64
+	// MaxTime is the timestamp of the newest samples in milliseconds. If 0, current time is used.
+	MaxTime int64
+}
+
+// NumSeries returns the number of series generated from given config.
+func (c Config) NumSeries() int {
+	n := 0
+	for _, in := range c.InputSeries {
+		bases := len(in.Result.Result) * in.Replicate
+		if len(in.Cardinality.Labels) > 0 {
+			if bases == 0 {
+				bases = 1
+			}
+			bases *= in.Cardinality.NumSeries()
+		}
+		n += bases
+	}
+	return n
 }
 
 type Series struct {
 	Type string // gauge, counter (if counter we treat below as rate aim).
+	// Help and Unit are metric metadata written to WAL. If empty, generic help is used and unit is derived
+	// from the metric name suffix.
+	Help string
+	Unit string
 
 	Characteristics seriesgen.Characteristics
 
@@ -36,6 +66,9 @@ type Series struct {
 	// Replicate multiples this set given number of times. For example if result has 10 metrics and replicate is 10 we will
 	// have 100 unique series.
 	Replicate int
+	// Cardinality generates labels from a model, merged with labels of each result (and replica). If there are no
+	// results, only labels from the model are used.
+	Cardinality seriesgen.CardinalityModel
 }
 
 type QueryData struct {
@@ -43,19 +76,41 @@ type QueryData struct {
 	Result     model.Vector    `json:"result"`
 }
 
-func GenerateTSDBWAL(logger log.Logger, dir string, config Config) error {
+// GenerateTSDBWAL generates TSDB data with WAL in given directory. Append options, e.g. progress hook,
+// are passed to seriesgen.Append.
+func GenerateTSDBWAL(logger log.Logger, dir string, config Config, opts ...seriesgen.AppendOption) error {
 	if config.ScrapeInterval == 0 {
 		config.ScrapeInterval = 15 * time.Second
 	}
 
+	if config.MaxExemplars == 0 {
+		for _, in := range config.InputSeries {
+			if in.Characteristics.Exemplars.Probability > 0 {
+				config.MaxExemplars = 100000
+				break
+			}
+		}
+	}
+
+	if config.OutOfOrderTimeWindow == 0 {
+		for _, in := range config.InputSeries {
+			if in.Characteristics.OutOfOrder.Probability > 0 && in.Characteristics.OutOfOrder.Window > config.OutOfOrderTimeWindow {
+				config.OutOfOrderTimeWindow = in.Characteristics.OutOfOrder.Window
+			}
+		}
+	}
+
 	maxBlockDuration := config.Retention / 10
 	// TODO(bwplotka): Moved to something like https://github.com/thanos-io/thanos/blob/master/pkg/testutil/prometheus.go#L289
 	//  to actually generate blocks! It will be fine for TSDB use cases as well.
 	db, err := tsdb.Open(dir, nil, nil, &tsdb.Options{
-		MinBlockDuration:  int64(2 * time.Hour / time.Millisecond),
-		MaxBlockDuration:  maxBlockDuration.Milliseconds(),
-		RetentionDuration: config.Retention.Milliseconds(),
-		NoLockfile:        true,
+		MinBlockDuration:      int64(2 * time.Hour / time.Millisecond),
+		MaxBlockDuration:      maxBlockDuration.Milliseconds(),
+		RetentionDuration:     config.Retention.Milliseconds(),
+		NoLockfile:            true,
+		EnableExemplarStorage: config.MaxExemplars > 0,
+		MaxExemplars:          config.MaxExemplars,
+		OutOfOrderTimeWindow:  config.OutOfOrderTimeWindow.Milliseconds(),
 	}, nil)
 	if err != nil {
 		level.Error(logger).Log("err", err)
@@ -64,14 +119,15 @@ func GenerateTSDBWAL(logger log.Logger, dir string, config Config) error {
 
 	// Of course there will be small gap in minTime vs time.Now once we finish.
 	// We are fine with this.
-	n := time.Now()
-	maxTime := timestamp.FromTime(n)
-	minTime := timestamp.FromTime(n.Add(-config.Retention))
-
-	random := rand.New(rand.NewSource(1234))
+	maxTime := config.MaxTime
+	if maxTime == 0 {
+		maxTime = timestamp.FromTime(time.Now())
+	}
+	minTime := maxTime - config.Retention.Milliseconds()
 
 	set := &Set{}
 	for _, in := range config.InputSeries {
+		var bases []labels.Labels
 		for _, r := range in.Result.Result {
 			for i := 0; i < in.Replicate; i++ {
 				lset := labels.New()
@@ -81,19 +137,44 @@ func GenerateTSDBWAL(logger log.Logger, dir string, config Config) error {
 				if i > 0 {
 					lset = append(lset, labels.Label{Name: "blockgen_fake_replica", Value: strconv.Itoa(i)})
 				}
-				switch strings.ToLower(in.Type) {
-				case "counter":
-					set.s = append(set.s, seriesgen.NewSeriesGen(lset, seriesgen.NewCounterGen(random, minTime, maxTime, in.Characteristics)))
-				case "gauge":
-					set.s = append(set.s, seriesgen.NewSeriesGen(lset, seriesgen.NewGaugeGen(random, minTime, maxTime, in.Characteristics)))
-				default:
-					return errors.Errorf("failed to parse series, unknown metric type: %s", in.Type)
+				bases = append(bases, lset)
+			}
+		}
+
+		create := func(lset labels.Labels) ([]seriesgen.Series, error) {
+			s, err := newSeries(config.Seed, in, lset, minTime, maxTime)
+			if err != nil {
+				return nil, err
+			}
+			return []seriesgen.Series{s}, nil
+		}
+		if len(in.Cardinality.Labels) == 0 {
+			for _, lset := range bases {
+				s, err := newSeries(config.Seed, in, lset, minTime, maxTime)
+				if err != nil {
+					return err
 				}
+				set.s = append(set.s, s)
+			}
+			continue
+		}
+
+		if len(bases) == 0 {
+			bases = append(bases, labels.New())
+		}
+		for _, lset := range bases {
+			random := rand.New(rand.NewSource(seriesgen.SeriesSeed(config.Seed, lset)))
+			cset := seriesgen.NewCardinalitySet(random, in.Cardinality, lset, create)
+			for cset.Next() {
+				set.s = append(set.s, cset.At())
+			}
+			if err := cset.Err(); err != nil {
+				return errors.Wrapf(err, "generate series from cardinality model for %s", lset)
 			}
 		}
 	}
 
-	if err := seriesgen.Append(context.Background(), 2*runtime.GOMAXPROCS(0), db, set); err != nil {
+	if err := seriesgen.Append(context.Background(), 2*runtime.GOMAXPROCS(0), db, set, opts...); err != nil {
 		return errors.Wrap(err, "commit")
 	}
 
@@ -106,6 +187,29 @@ func GenerateTSDBWAL(logger log.Logger, dir string, config Config) error {
 	return nil
 }
 
+func newSeries(seed int64, in Series, lset labels.Labels, minTime, maxTime int64) (seriesgen.Series, error) {
+	// Stable random per series, so series are reproducible regardless of the order they are appended in.
+	random := rand.New(rand.NewSource(seriesgen.SeriesSeed(seed, lset)))
+	var (
+		iter seriesgen.SeriesIterator
+		typ  textparse.MetricType
+	)
+	switch strings.ToLower(in.Type) {
+	case "counter":
+		iter = seriesgen.NewCounterGen(random, minTime, maxTime, in.Characteristics)
+		typ = textparse.MetricTypeCounter
+	case "gauge":
+		iter = seriesgen.NewGaugeGen(random, minTime, maxTime, in.Characteristics)
+		typ = textparse.MetricTypeGauge
+	default:
+		return nil, errors.Errorf("failed to parse series, unknown metric type: %s", in.Type)
+	}
+	return seriesgen.WithMetadata(
+		seriesgen.NewSeriesGen(lset, seriesgen.WithCharacteristics(random, iter, minTime, maxTime, in.Characteristics)),
+		seriesgen.NewMetadata(typ, lset, in.Help, in.Unit),
+	), nil
+}
+
 type Set struct {
 	s    []seriesgen.Series
 	curr int